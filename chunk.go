@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// lineScanner is a bufio.Scanner of lines which records the bytes consumed by each line, including the line terminator
+type lineScanner struct {
+	*bufio.Scanner
+	advance int
+}
+
+// newLineScanner returns a lineScanner of r, split by split or bufio.ScanLines if nil, which fails on lines longer than maxLineSize
+func newLineScanner(r io.Reader, split bufio.SplitFunc, maxLineSize int) *lineScanner {
+	if split == nil {
+		split = bufio.ScanLines
+	}
+	sc := &lineScanner{
+		Scanner: bufio.NewScanner(r),
+	}
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		a, token, err := split(data, atEOF)
+		if token != nil {
+			sc.advance = a
+		}
+		return a, token, err
+	})
+	return sc
+}
+
+// scannedLine contains a LineNode classified by classifyChunks and the data it was classified from
+type scannedLine struct {
+	line   *LineNode
+	data   string
+	offset int
+	bom    int
+}
+
+// lineClassifier classifies lines by Line with the state carried from the previous line: whether a CommentBlock is open and the previous LineNode
+type lineClassifier struct {
+	state *FileNode
+	last  *FileNode
+}
+
+// newLineClassifier returns a lineClassifier without preceding lines
+func newLineClassifier() *lineClassifier {
+	c := &lineClassifier{
+		state: &FileNode{},
+	}
+	c.last = &FileNode{
+		Parent: c.state,
+	}
+	c.state.Child = []*FileNode{c.last}
+	return c
+}
+
+// classify returns the LineNode of data and records it as the previous line
+func (c *lineClassifier) classify(data string, configuration *Configuration) *LineNode {
+	line := Line(c.state, data, configuration)
+	c.last.Line = line
+	return line
+}
+
+// neutral returns true if the next line is classified as if there were no preceding lines; that is no CommentBlock is open and the previous line is not exposed
+func (c *lineClassifier) neutral() bool {
+	last := c.last.Line
+	return !c.state.withinBlock && !last.IsExposed() && (!last.IsCommentBlockStart() || last.IsCommentBlockEnd())
+}
+
+// classifyChunks splits data into newline aligned chunks of about Configuration.ParallelChunkSize bytes and classifies the lines of each concurrently, returning every line in order;
+// each chunk is classified as if it had no preceding lines, and then classified again, in order, only if the preceding chunk ends within a comment block or exposed lines; false is returned, for a sequential scan, if any chunk cannot be scanned
+func classifyChunks(data []byte, configuration *Configuration, maxLineSize int) ([]*scannedLine, bool) {
+	var bounds [][2]int
+	for start := 0; start < len(data); {
+		end := start + configuration.ParallelChunkSize
+		if end >= len(data) {
+			end = len(data)
+		} else if n := bytes.IndexByte(data[end:], '\n'); n < 0 {
+			end = len(data)
+		} else {
+			end += n + 1
+		}
+		bounds = append(bounds, [2]int{start, end})
+		start = end
+	}
+	chunks := make([][]*scannedLine, len(bounds))
+	classifiers := make([]*lineClassifier, len(bounds))
+	ok := make([]bool, len(bounds))
+	var wg sync.WaitGroup
+	for c, b := range bounds {
+		wg.Add(1)
+		go func(c int, start int, end int) {
+			defer wg.Done()
+			classifier := newLineClassifier()
+			sc := newLineScanner(bytes.NewReader(data[start:end]), nil, maxLineSize)
+			offset := start
+			for sc.Scan() {
+				s := &scannedLine{
+					data:   sc.Text(),
+					offset: offset,
+				}
+				if offset == 0 && strings.HasPrefix(s.data, "\uFEFF") {
+					// UTF-8 byte order mark
+					s.bom = len("\uFEFF")
+					s.data = s.data[s.bom:]
+				}
+				s.line = classifier.classify(s.data, configuration)
+				chunks[c] = append(chunks[c], s)
+				offset += sc.advance
+			}
+			classifiers[c] = classifier
+			ok[c] = sc.Err() == nil
+		}(c, b[0], b[1])
+	}
+	wg.Wait()
+	var scanned []*scannedLine
+	var classifier *lineClassifier
+	for c := range chunks {
+		if !ok[c] {
+			return nil, false
+		}
+		if classifier != nil && !classifier.neutral() {
+			// The chunk continues the comment block or exposed lines of the preceding chunk
+			for _, s := range chunks[c] {
+				s.line = classifier.classify(s.data, configuration)
+			}
+		} else {
+			classifier = classifiers[c]
+		}
+		scanned = append(scanned, chunks[c]...)
+	}
+	return scanned, true
+}
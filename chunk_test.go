@@ -0,0 +1,101 @@
+package core_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emits-io/core"
+)
+
+func buildChunked(t testing.TB, data string, chunkSize int) string {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader(data), "main.go", &core.Configuration{
+		Expose: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		ParallelChunkSize: chunkSize,
+	})
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %v", err)
+	}
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() expects nil, got %v", err)
+	}
+	return buf.String()
+}
+
+func chunkedSource(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "// .function f%v\r\n//   .param x\nfunc f%v(x int) {\n\treturn\n}\n\n", i, i)
+	}
+	return b.String()
+}
+
+func blockSource(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "/*\n.function f%v\n  .param x\n*/\nfunc f%v(x int) {\n\treturn\n}\n// .example f%v >\nf%v(1)\nf%v(2)\n\n", i, i, i, i, i)
+	}
+	return b.String()
+}
+
+func Test_BuildReader_ParallelChunkSize(t *testing.T) {
+	for name, data := range map[string]string{
+		"lines":  "\uFEFF" + chunkedSource(64),
+		"block":  chunkedSource(16) + "/*\n.note block\n*/\n" + chunkedSource(16),
+		"expose": chunkedSource(16) + "// .example usage >\nf0(1)\n" + chunkedSource(16),
+		"blocks": blockSource(32),
+		"spans":  chunkedSource(4) + "/*\n" + strings.Repeat(".note block\n", 64) + "*/\n// .example usage >\n" + strings.Repeat("f0(1)\n", 64) + chunkedSource(4),
+		"empty":  "",
+	} {
+		sequential := buildChunked(t, data, 0)
+		for _, size := range []int{1, 16, 100, 1 << 20} {
+			parallel := buildChunked(t, data, size)
+			if parallel != sequential {
+				t.Errorf("BuildReader() expects %v with chunk size %v to equal the sequential scan, got %v", name, size, parallel)
+			}
+		}
+	}
+}
+
+func Benchmark_BuildReader_Sequential(b *testing.B) {
+	data := chunkedSource(200)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buildChunked(b, data, 0)
+	}
+}
+
+func Benchmark_BuildReader_ParallelChunkSize(b *testing.B) {
+	data := chunkedSource(200)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buildChunked(b, data, 8<<10)
+	}
+}
+
+func Benchmark_BuildReader_Block_Sequential(b *testing.B) {
+	data := blockSource(200)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buildChunked(b, data, 0)
+	}
+}
+
+func Benchmark_BuildReader_Block_ParallelChunkSize(b *testing.B) {
+	data := blockSource(200)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		buildChunked(b, data, 8<<10)
+	}
+}
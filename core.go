@@ -2,12 +2,21 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -19,14 +28,186 @@ const (
 	EmitsRegex     = "^\\.(\\w+)(\\`(.+)\\`)?\\s(.+)"
 	EmitsFlagRegex = "(.+?):(.+)"
 	FlagSplit      = ","
+	// EmitsRegexFormat is EmitsRegex with the keyword prefix as a verb
+	EmitsRegexFormat = "^%v(\\w+)(\\`(.+)\\`)?\\s(.+)"
+	// DefaultEmitsPrefix is the keyword prefix used when Configuration.EmitsPrefix is not set
+	DefaultEmitsPrefix = "."
+	// GzipExtension marks a gzip compressed file, decompressed by Build
+	GzipExtension = ".gz"
+	// Stdin is the Build path used to read from standard input
+	Stdin     = "-"
+	StdinName = "<stdin>"
+	// DiagnosticError and DiagnosticWarning are the Diagnostic severities
+	DiagnosticError   = "error"
+	DiagnosticWarning = "warning"
+	// SeverityFlag is the EmitFlag name compared against Configuration.MinSeverity
+	SeverityFlag = "severity"
+	// ScopeAll applies a RegularExpression to every line
+	ScopeAll = "all"
+	// ScopeComment applies a RegularExpression to comment lines only
+	ScopeComment = "comment"
+	// ScopeExposed applies a RegularExpression to exposed code lines only
+	ScopeExposed = "exposed"
+	// LineAdded, LineRemoved and LineChanged are the LineChange kinds
+	LineAdded   = "added"
+	LineRemoved = "removed"
+	LineChanged = "changed"
+	// FlagDuplicateKeep keeps every EmitFlag with a repeated name
+	FlagDuplicateKeep = "keep"
+	// FlagDuplicateLast keeps only the last EmitFlag with a repeated name
+	FlagDuplicateLast = "last"
+	// FlagDuplicateError fails Emit on an EmitFlag with a repeated name
+	FlagDuplicateError = "error"
+	// PathFlag is the EmitFlag name of the file referenced by Configuration.IncludeKeyword
+	PathFlag = "path"
+	// SymbolFlag is the EmitFlag name populated by Configuration.SymbolPattern
+	SymbolFlag = "symbol"
+	// FileFlag is the EmitFlag name of the file wrapped by Configuration.RootKeyword
+	FileFlag = "file"
+	// DefaultValueJoin joins coalesced values when Configuration.ValueJoin is not set
+	DefaultValueJoin = "\n"
+	// NestByIndent nests each line within the preceding line of lesser indentation
+	NestByIndent = "indent"
+	// NestByKeywordDepth nests each keyword line by its number of repeated keyword prefixes, e.g. .item then ..subitem, and other lines within the preceding keyword
+	NestByKeywordDepth = "keyword-depth"
+	// DefaultMaxLineSize is the maximum line size, in bytes, scanned when Configuration.MaxLineSize is not set
+	DefaultMaxLineSize = 1024 * 1024
+	// DefaultMaxPluginOutputBytes is the maximum intermediate file size, in bytes, read from a plugin when Configuration.MaxPluginOutputBytes is not set
+	DefaultMaxPluginOutputBytes = 64 * 1024 * 1024
 )
 
+// languageExtension maps a file extension to its language
+var languageExtension = map[string]string{
+	".c":    "c",
+	".h":    "c",
+	".go":   "go",
+	".htm":  "html",
+	".html": "html",
+	".js":   "javascript",
+	".lua":  "lua",
+	".py":   "python",
+	".rb":   "ruby",
+	".sql":  "sql",
+	".ts":   "typescript",
+}
+
+// languageComment maps a language to its comment tokens; an empty token is disabled
+var languageComment = map[string]Comment{
+	"c":          {Line: "//", Block: &CommentBlock{Start: "/*", End: "*/"}},
+	"go":         {Line: "//", Block: &CommentBlock{Start: "/*", End: "*/"}},
+	"html":       {Block: &CommentBlock{Start: "<!--", End: "-->"}},
+	"javascript": {Line: "//", Block: &CommentBlock{Start: "/*", End: "*/"}},
+	"lua":        {Line: "--", Block: &CommentBlock{Start: "--[[", End: "]]"}},
+	"python":     {Line: "#", Block: &CommentBlock{}},
+	"ruby":       {Line: "#", Block: &CommentBlock{Start: "=begin", End: "=end"}},
+	"sql":        {Line: "--", Block: &CommentBlock{Start: "/*", End: "*/"}},
+	"typescript": {Line: "//", Block: &CommentBlock{Start: "/*", End: "*/"}},
+}
+
+// DefaultSeverityOrder ranks severities from lowest to highest when Configuration.SeverityOrder is not set
+var DefaultSeverityOrder = []string{"debug", "info", "warning", "error", "critical"}
+
 // Configuration contains all options used to establish processing of FileNode
 type Configuration struct {
+	Language          string
 	Expose            bool
 	Comment           *Comment
 	Plugin            *[]Plugin
 	RegularExpression *[]RegularExpression
+	// PluginDirectory contains executable Plugin files which run after Plugin
+	PluginDirectory []string
+	// PluginWorkingDir is the working directory of each Plugin
+	PluginWorkingDir string
+	// EmitsPrefix precedes each keyword; defaults to DefaultEmitsPrefix
+	EmitsPrefix string
+	// FlagSplit delimits flags; defaults to FlagSplit
+	FlagSplit string
+	// InheritFlags names the flags a keyword EmitNode inherits from its ancestors
+	InheritFlags []string
+	// NestedFlags parses brace delimited EmitFlag values into EmitFlag.Flag
+	NestedFlags bool
+	// FlagDuplicatePolicy handles a repeated EmitFlag; defaults to FlagDuplicateKeep
+	FlagDuplicatePolicy string
+	// SortFlags sorts each EmitNode.Flag by name
+	SortFlags bool
+	// FlagUnquote removes the double quotes surrounding an EmitFlag value
+	FlagUnquote bool
+	// SplitValues populates EmitNode.Values with the tokens of each keyword value
+	SplitValues bool
+	// DryRun records the intermediate file in FileNode.Intermediate instead of running plugins
+	DryRun bool
+	// PluginDiff records each line changed by plugins in FileNode.PluginDiff
+	PluginDiff bool
+	// ReEmitAfterPlugin reclassifies each LineNode value changed by a plugin
+	ReEmitAfterPlugin bool
+	// ValidateLineNumbers records a Diagnostic for each line number out of order after plugins
+	ValidateLineNumbers bool
+	// RenumberLines ensures line numbers increase after plugins
+	RenumberLines bool
+	// PrimaryKeyword promotes the value of the first EmitNode with this keyword to EmitMeta.Title
+	PrimaryKeyword string
+	// Schema validates each keyword EmitNode during Emit
+	Schema map[string]KeywordSchema
+	// ExposeBlock emits the code exposed by a comment line as a single EmitNode
+	ExposeBlock bool
+	// PreserveExposedWhitespace retains blank lines within exposed code
+	PreserveExposedWhitespace bool
+	// Include limits directory builds to paths matching any of these patterns
+	Include []string
+	// Exclude skips directory builds of paths matching any of these patterns
+	Exclude []string
+	// RegexAfterEmit applies RegularExpression to each EmitNode.Value during Emit
+	RegexAfterEmit bool
+	// RegexDebug records in LineNode.Modified each RegularExpression which changed it
+	RegexDebug bool
+	// RegexTimeout bounds each RegularExpression replacement; zero is unbounded
+	RegexTimeout time.Duration
+	// MaxRegexCount is the maximum number of RegularExpression; zero is unlimited
+	MaxRegexCount int
+	// LineTagPattern matches the EmitNode tag on a comment line
+	LineTagPattern string
+	// TabWidth is the column width of a tab when computing LineNode.Indent
+	TabWidth int
+	// Coalesce joins keywordless, childless EmitNode values into their keyword parent
+	Coalesce bool
+	// ValueJoin is used to join coalesced values; defaults to DefaultValueJoin
+	ValueJoin string
+	// EmitSourceLine serializes EmitNode.Line as line on every EmitNode
+	EmitSourceLine bool
+	// EmitSourceFile serializes the name of the file defining every EmitNode as file
+	EmitSourceFile bool
+	// EmitEmptyArrays renders empty EmitNode and EmitFile arrays rather than omitting them
+	EmitEmptyArrays bool
+	// EmitContentHash populates EmitNode.ContentHash on every keyword EmitNode
+	EmitContentHash bool
+	// MinSeverity removes keyword EmitNode whose SeverityFlag ranks below it
+	MinSeverity string
+	// SeverityOrder ranks severities from lowest to highest; defaults to DefaultSeverityOrder
+	SeverityOrder []string
+	// Decompress gzip decompresses every file read by Build
+	Decompress bool
+	// MaxLineSize is the maximum line size scanned by Build; defaults to DefaultMaxLineSize
+	MaxLineSize int
+	// MaxPluginOutputBytes is the maximum intermediate file size read from each plugin
+	MaxPluginOutputBytes int
+	// SplitFunc splits the file into lines; defaults to bufio.ScanLines
+	SplitFunc bufio.SplitFunc
+	// ParallelChunkSize classifies lines concurrently in chunks of about this many bytes
+	ParallelChunkSize int
+	// MetaKeyword hoists each top level EmitNode with this keyword into EmitMeta.Data
+	MetaKeyword string
+	// SymbolPattern matches the code symbol following a comment block
+	SymbolPattern string
+	// NestBy builds the FileNode tree by NestByIndent or NestByKeywordDepth
+	NestBy string
+	// LineContinuation joins the next comment line to one ending with it
+	LineContinuation string
+	// IncludeKeyword attaches the Data of the file referenced by this keyword
+	IncludeKeyword string
+	// RootKeyword wraps every top level EmitNode in an EmitNode with this keyword
+	RootKeyword string
+	// Now returns the time used for EmitMeta.Timestamp; defaults to time.Now
+	Now func() time.Time
 }
 
 // Plugin contains all options used to establish processing of FileNode
@@ -36,9 +217,67 @@ type Plugin struct {
 
 // RegularExpression contains all options used to establish processing of FileNode
 type RegularExpression struct {
-	Find     string         `json:"find"`
-	Replace  string         `json:"replace"`
-	Compiled *regexp.Regexp `json:"-"`
+	Find       string `json:"find"`
+	Replace    string `json:"replace"`
+	IgnoreCase bool   `json:"ignoreCase,omitempty"`
+	Multiline  bool   `json:"multiline,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	// ReplaceFunc, if set, replaces each match and takes precedence over Replace
+	ReplaceFunc func(match string) string `json:"-"`
+	Compiled    *regexp.Regexp            `json:"-"`
+}
+
+// replace returns value with each match of Compiled replaced by ReplaceFunc or Replace
+func (r RegularExpression) replace(value string) string {
+	if r.ReplaceFunc != nil {
+		return r.Compiled.ReplaceAllStringFunc(value, r.ReplaceFunc)
+	}
+	return r.Compiled.ReplaceAllString(value, r.Replace)
+}
+
+// replaceWithin returns the replaced value, or the value unchanged and false if a positive timeout elapses first; the replacement cannot be interrupted, so it is abandoned to finish in the background
+func (r RegularExpression) replaceWithin(value string, timeout time.Duration) (string, bool) {
+	if timeout <= 0 {
+		return r.replace(value), true
+	}
+	result := make(chan string, 1)
+	go func() {
+		result <- r.replace(value)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case replaced := <-result:
+		return replaced, true
+	case <-timer.C:
+		return value, false
+	}
+}
+
+// applies returns true if the Scope, which defaults to ScopeAll, includes the provided LineNode
+func (r RegularExpression) applies(l *LineNode) bool {
+	switch r.Scope {
+	case ScopeComment:
+		return l.IsComment()
+	case ScopeExposed:
+		return l.IsExposed() && !l.IsComment()
+	}
+	return true
+}
+
+// pattern returns Find prefixed by the flags of IgnoreCase and Multiline
+func (r RegularExpression) pattern() string {
+	flags := ""
+	if r.IgnoreCase {
+		flags += "i"
+	}
+	if r.Multiline {
+		flags += "m"
+	}
+	if len(flags) == 0 {
+		return r.Find
+	}
+	return "(?" + flags + ")" + r.Find
 }
 
 // Comment contains all the options used to establish a comment on LineNode
@@ -51,6 +290,10 @@ type Comment struct {
 type CommentBlock struct {
 	Start string `json:"start"`
 	End   string `json:"end"`
+	// Symmetric allows Start and End to be equal; see Configuration.Validate
+	Symmetric bool `json:"symmetric,omitempty"`
+	// ContinuationPrefix, if set, is removed from the start of each line within the block, e.g. the * of JSDoc
+	ContinuationPrefix string `json:"continuationPrefix,omitempty"`
 }
 
 // LineNode contains all the options used to process Plugin and RegEx functions
@@ -63,48 +306,181 @@ type LineNode struct {
 	Value             string `json:"value,omitempty"`
 	Indent            int    `json:"indent,omitempty"`
 	Number            int    `json:"number,omitempty"`
+	StartOffset       int    `json:"offset,omitempty"`
+	ValueColumn       int    `json:"column,omitempty"`
+	Symbol            string `json:"symbol,omitempty"`
+	Modified          []int  `json:"modified,omitempty"`
 }
 
 // FileNode contains the tree structure for LineNode
 type FileNode struct {
-	Line       *LineNode   `json:"line,omitempty"`
-	Parent     *FileNode   `json:"-"`
-	ParentLine int         `json:"parent,omitempty"`
-	Child      []*FileNode `json:"child,omitempty"`
+	Name          string        `json:"-"`
+	Language      string        `json:"-"`
+	Line          *LineNode     `json:"line,omitempty"`
+	Parent        *FileNode     `json:"-"`
+	ParentLine    int           `json:"parent,omitempty"`
+	Child         []*FileNode   `json:"child,omitempty"`
+	Diagnostic    []*Diagnostic `json:"-"`
+	Intermediate  []byte        `json:"-"`
+	PluginDiff    []*LineChange `json:"-"`
+	configuration *Configuration
+	insertion     *insertion
+	// withinBlock is set while Line is between the start and end of a CommentBlock
+	withinBlock bool
+	// emitted is set once Emit is called, when diagnosed records the number of Diagnostic from Build
+	emitted   bool
+	diagnosed int
+	// inferred is set if Comment was inferred from the extension of Name, so each included file infers its own
+	inferred bool
+}
+
+// insertion contains the path from the first FileNode to the last inserted FileNode and the path positions of each indent
+type insertion struct {
+	path   []*FileNode
+	indent map[int][]int
+}
+
+// LineChange contains the value of a line number before and after plugins; see Configuration.PluginDiff
+type LineChange struct {
+	Line   int    `json:"line"`
+	Change string `json:"change"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// BuildResult contains the FileNode, EmitNode, EmitFile, Diagnostic, and timing of BuildAndEmit
+type BuildResult struct {
+	FileNode      *FileNode
+	EmitNode      *EmitNode
+	EmitFile      *EmitFile
+	Diagnostic    []*Diagnostic
+	BuildDuration time.Duration
+	EmitDuration  time.Duration
+}
+
+// Diagnostic contains a problem found while processing FileNode
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+// BuildError contains every error which caused a step of Build to fail; use errors.As to inspect each
+type BuildError struct {
+	Message string
+	Err     []error
+}
+
+// Error returns the Message followed by every error
+func (e *BuildError) Error() string {
+	messages := make([]string, 0, len(e.Err))
+	for _, err := range e.Err {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%v: %v", e.Message, strings.Join(messages, ", "))
+}
+
+// Unwrap returns every error for errors.Is and errors.As from Go 1.20
+func (e *BuildError) Unwrap() []error {
+	return e.Err
+}
+
+// Is returns true if any error matches target; errors.Is calls it before Go 1.20 walks Unwrap
+func (e *BuildError) Is(target error) bool {
+	for _, err := range e.Err {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error which matches target, and if so sets target to it and returns true; errors.As calls it before Go 1.20 walks Unwrap
+func (e *BuildError) As(target interface{}) bool {
+	for _, err := range e.Err {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
 
 // EmitNode contains data used by Emits
 type EmitNode struct {
-	Keyword string      `json:"keyword,omitempty"`
-	Flag    []*EmitFlag `json:"flag,omitempty"`
-	Value   string      `json:"value,omitempty"`
-	Data    []*EmitNode `json:"data,omitempty"`
-	Line    int         `json:"-"`
+	Keyword     string      `json:"keyword,omitempty" xml:"keyword,attr,omitempty"`
+	Flag        []*EmitFlag `json:"flag,omitempty" xml:"flag"`
+	Value       string      `json:"value,omitempty" xml:"value,attr,omitempty"`
+	Values      []string    `json:"values,omitempty" xml:"values"`
+	Tag         []string    `json:"tag,omitempty" xml:"tag"`
+	ContentHash string      `json:"contentHash,omitempty" xml:"contentHash,attr,omitempty"`
+	LineStart   int         `json:"lineStart,omitempty" xml:"lineStart,attr,omitempty"`
+	LineEnd     int         `json:"lineEnd,omitempty" xml:"lineEnd,attr,omitempty"`
+	Data        []*EmitNode `json:"data,omitempty" xml:"data"`
+	Line        int         `json:"-" xml:"-"`
+	Meta        *EmitMeta   `json:"-" xml:"-"`
+	now         func() time.Time
+	emptyArrays bool
+	// sourceLine and sourceFile are serialized as line and file; see Configuration.EmitSourceLine and EmitSourceFile
+	sourceLine bool
+	sourceFile string
+}
+
+// emitter contains the compiled state used to Process FileNode into EmitNode; root records each Diagnostic
+type emitter struct {
+	configuration *Configuration
+	file          string
+	root          *FileNode
+	regexEmits    *regexp.Regexp
+	regexFlag     *regexp.Regexp
+	regexTag      *regexp.Regexp
 }
 
-// EmitFlag contains options used by EmitNode
+// EmitFlag contains options used by EmitNode; name:value sets both, name: sets only Name and a bare value sets only Value
 type EmitFlag struct {
-	Name  string `json:"name,omitempty"`
-	Value string `json:"value,omitempty"`
+	Name  string      `json:"name,omitempty" xml:"name,attr,omitempty"`
+	Value string      `json:"value,omitempty" xml:"value,attr,omitempty"`
+	Flag  []*EmitFlag `json:"flag,omitempty" xml:"flag"`
 }
 
 // EmitMeta contains data used to identify the source file
 type EmitMeta struct {
-	File      string      `json:"file"`
-	Data      []*MetaData `json:"data,omitempty"`
-	Timestamp string      `json:"timestamp"`
+	File      string      `json:"file" xml:"file,attr"`
+	Language  string      `json:"language,omitempty" xml:"language,attr,omitempty"`
+	Title     string      `json:"title,omitempty" xml:"title,attr,omitempty"`
+	Data      []*MetaData `json:"data,omitempty" xml:"data"`
+	Timestamp string      `json:"timestamp" xml:"timestamp,attr"`
+	Source    []*EmitMeta `json:"source,omitempty" xml:"source"`
 }
 
 // MetaData contains data used to identify the source file meta data
 type MetaData struct {
-	Keyword string `json:"keyword,omitempty"`
-	Value   string `json:"value,omitempty"`
+	Keyword string `json:"keyword,omitempty" xml:"keyword,attr,omitempty"`
+	Value   string `json:"value,omitempty" xml:"value,attr,omitempty"`
 }
 
 // EmitFile Emits contains the standardized data structure based on EmitNode
 type EmitFile struct {
-	Meta *EmitMeta   `json:"meta"`
-	Data []*EmitNode `json:"data"`
+	Meta *EmitMeta   `json:"meta" xml:"meta"`
+	Data []*EmitNode `json:"data" xml:"data"`
+}
+
+// FileSummary contains a compact summary of EmitFile
+type FileSummary struct {
+	File      string         `json:"file"`
+	Directive int            `json:"directive"`
+	Keyword   map[string]int `json:"keyword,omitempty"`
+	Hash      string         `json:"hash"`
+}
+
+// EmitRow contains a denormalized EmitNode and one of its EmitFlag; FlagName and FlagValue are nil for EmitNode without EmitFlag
+type EmitRow struct {
+	File      string  `json:"file"`
+	Line      int     `json:"line"`
+	Depth     int     `json:"depth"`
+	Keyword   string  `json:"keyword"`
+	FlagName  *string `json:"flag_name"`
+	FlagValue *string `json:"flag_value"`
+	Value     string  `json:"value"`
 }
 
 // MarshalJSON sets the ParentLine, if available, for plugin use
@@ -117,30 +493,108 @@ func (f *FileNode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(*f)
 }
 
+// MarshalJSON renders a nil Flag and Data as empty arrays, rather than omitting them, if Configuration.EmitEmptyArrays
+func (e *EmitNode) MarshalJSON() ([]byte, error) {
+	type emitNode EmitNode
+	type sourceNode struct {
+		*emitNode
+		Line int    `json:"line,omitempty"`
+		File string `json:"file,omitempty"`
+	}
+	node := &sourceNode{
+		emitNode: (*emitNode)(e),
+		File:     e.sourceFile,
+	}
+	if e.sourceLine {
+		node.Line = e.Line
+	}
+	if !e.emptyArrays {
+		return json.Marshal(node)
+	}
+	flag, data := e.Flag, e.Data
+	if flag == nil {
+		flag = []*EmitFlag{}
+	}
+	if data == nil {
+		data = []*EmitNode{}
+	}
+	return json.Marshal(&struct {
+		*sourceNode
+		Flag []*EmitFlag `json:"flag"`
+		Data []*EmitNode `json:"data"`
+	}{
+		sourceNode: node,
+		Flag:       flag,
+		Data:       data,
+	})
+}
+
+// LanguageForExtension returns the language of the provided file extension, or an empty string if unknown
+func LanguageForExtension(ext string) string {
+	return languageExtension[strings.ToLower(ext)]
+}
+
+// CommentForExtension returns the comment tokens of the provided file extension, or nil if unknown
+func CommentForExtension(ext string) *Comment {
+	comment, ok := languageComment[LanguageForExtension(ext)]
+	if !ok {
+		return nil
+	}
+	block := *comment.Block
+	comment.Block = &block
+	return &comment
+}
+
 // Line returns LineNode
 func Line(fileNode *FileNode, value string, configuration *Configuration) *LineNode {
+	// Carriage Return (CRLF line endings)
+	value = strings.TrimSuffix(value, "\r")
 	// Indent
-	indent := 0
+	offset, column := 0, 0
 	for i, r := range value {
-		indent = i
+		offset = i
 		if !unicode.IsSpace(r) {
 			break
 		}
+		if r == '\t' && configuration.TabWidth > 0 {
+			column += configuration.TabWidth - column%configuration.TabWidth
+		} else {
+			column++
+		}
+	}
+	indent := offset
+	if configuration.TabWidth > 0 {
+		indent = column
 	}
 	data := &LineNode{
 		Indent: indent,
 	}
-	value = value[indent:]
-	// Explicit Comment
-	if strings.HasPrefix(value, configuration.Comment.Block.Start) {
+	value = value[offset:]
+	start := offset
+	block := configuration.Comment.Block
+	// Explicit Comment (empty tokens are disabled); within a CommentBlock the End is matched first, as Start and End may be equal
+	if fileNode.withinBlock && len(block.End) > 0 && strings.HasSuffix(value, block.End) {
+		data.CommentBlockEnd = true
+		value = strings.TrimSuffix(value, block.End)
+		fileNode.withinBlock = false
+	} else if len(block.Start) > 0 && strings.HasPrefix(value, block.Start) {
 		data.CommentBlockStart = true
-		value = strings.TrimPrefix(value, configuration.Comment.Block.Start)
-	} else if strings.HasSuffix(value, configuration.Comment.Block.End) {
+		value = strings.TrimPrefix(value, block.Start)
+		start += len(block.Start)
+		// Single line CommentBlock
+		if len(block.End) > 0 && strings.HasSuffix(value, block.End) {
+			data.CommentBlockEnd = true
+			value = strings.TrimSuffix(value, block.End)
+		}
+		fileNode.withinBlock = !data.CommentBlockEnd
+	} else if len(block.End) > 0 && strings.HasSuffix(value, block.End) {
 		data.CommentBlockEnd = true
-		value = strings.TrimSuffix(value, configuration.Comment.Block.End)
-	} else if strings.HasPrefix(value, configuration.Comment.Line) {
+		value = strings.TrimSuffix(value, block.End)
+		fileNode.withinBlock = false
+	} else if len(configuration.Comment.Line) > 0 && strings.HasPrefix(value, configuration.Comment.Line) {
 		data.CommentLine = true
 		value = strings.TrimPrefix(value, configuration.Comment.Line)
+		start += len(configuration.Comment.Line)
 		// Expose (only through comment line)
 		if configuration.Expose && strings.HasSuffix(value, Expose) {
 			data.Expose = true
@@ -152,69 +606,517 @@ func Line(fileNode *FileNode, value string, configuration *Configuration) *LineN
 		// Possible Expose
 		data.Expose = fileNode.IsExposedWithinBlock()
 	}
+	// Continuation Prefix
+	if len(block.ContinuationPrefix) > 0 && (data.CommentBlockStart || data.CommentBlockLine || data.CommentBlockEnd) {
+		trimmed := strings.TrimLeftFunc(value, unicode.IsSpace)
+		if strings.HasPrefix(trimmed, block.ContinuationPrefix) {
+			start += len(value) - len(trimmed) + len(block.ContinuationPrefix)
+			value = trimmed[len(block.ContinuationPrefix):]
+		}
+	}
 	// Possible Value
 	if data.IsCommentOrExposed() {
 		data.Value = strings.TrimSpace(value)
+		data.ValueColumn = start + len(value) - len(strings.TrimLeftFunc(value, unicode.IsSpace))
 	}
 	return data
 }
 
-// Build opens the provided file path and returns a FileNode based on Configuration
+// Build opens the provided file path and returns a FileNode based on Configuration; Stdin reads from standard input
 func (f *FileNode) Build(path string, configuration *Configuration) (*FileNode, error) {
-	file, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-	if err != nil {
-		return nil, fmt.Errorf("could not open file: %v", err)
+	return f.BuildContext(context.Background(), path, configuration)
+}
+
+// BuildContext is Build which aborts when the provided context.Context is done; an error closing the file is returned if no other error occurred
+func (f *FileNode) BuildContext(ctx context.Context, path string, configuration *Configuration) (node *FileNode, err error) {
+	var r io.Reader = os.Stdin
+	name := StdinName
+	if path != Stdin {
+		// The deferred close reports through the named err, which must not be shadowed
+		file, openErr := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+		if openErr != nil {
+			return nil, fmt.Errorf("could not open file: %v", openErr)
+		}
+		defer func(file *os.File) {
+			closeErr := file.Close()
+			if err == nil && closeErr != nil {
+				node, err = nil, fmt.Errorf("could not close file: %v", closeErr)
+			}
+		}(file)
+		r, name = file, path
 	}
-	defer func(file *os.File) {
-		err := file.Close()
+	// Gzip (the logical name excludes the extension)
+	if strings.HasSuffix(name, GzipExtension) || configuration != nil && configuration.Decompress {
+		gz, err := gzip.NewReader(r)
 		if err != nil {
+			return nil, fmt.Errorf("could not decompress file: %v", err)
 		}
-	}(file)
-	sc := bufio.NewScanner(file)
-	i := 0
-	for sc.Scan() {
-		i++
-		data := sc.Text()
-		f.Insert(i, Line(f, data, configuration))
+		defer gz.Close()
+		r, name = gz, strings.TrimSuffix(name, GzipExtension)
+	}
+	return f.BuildReaderContext(ctx, r, name, configuration)
+}
+
+// BuildReader scans the provided io.Reader and returns a FileNode based on Configuration; name is only used to identify the source in EmitMeta
+func (f *FileNode) BuildReader(r io.Reader, name string, configuration *Configuration) (*FileNode, error) {
+	return f.BuildReaderContext(context.Background(), r, name, configuration)
+}
+
+// BuildReaderContext is BuildReader which aborts when the provided context.Context is done
+func (f *FileNode) BuildReaderContext(ctx context.Context, r io.Reader, name string, configuration *Configuration) (*FileNode, error) {
+	configuration, err := f.configure(name, configuration)
+	if err != nil {
+		return nil, err
 	}
-	if err := sc.Err(); err != nil {
-		return nil, fmt.Errorf("could not scan file: %v", err)
+	err = f.scan(ctx, r, configuration, nil)
+	if err != nil {
+		return nil, err
 	}
 	// Sanitize
 	f.Sanitize()
 	// Plugins
-	err, pluginErr := f.Plugin(configuration.Plugin)
-	if err != nil {
-		return nil, fmt.Errorf("could not generate intermediate file for plugin: %v", err)
-	} else if pluginErr != nil {
-		pe := make([]string, len(pluginErr))
-		for _, e := range pluginErr {
-			pe = append(pe, e.Error())
+	if configuration.DryRun {
+		var intermediate bytes.Buffer
+		_, err = f.WriteTo(&intermediate)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate intermediate file for plugin: %v", err)
+		}
+		f.Intermediate = intermediate.Bytes()
+	} else {
+		err = f.runPlugins(ctx, configuration)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("could not run plugins: %v", strings.Join(pe, ","))
+	}
+	// Line Numbers (plugins may rewrite them)
+	if configuration.ValidateLineNumbers {
+		f.ValidateLineNumbers()
+	}
+	if configuration.RenumberLines {
+		f.RenumberLines()
 	}
 	// Regular Expressions
 	if configuration.RegularExpression != nil {
-		err = configuration.CompileRegularExpressions()
+		err = configuration.compileRegularExpressions()
 		if err != nil {
 			return nil, err
 		}
-		f.RegularExpression(configuration.RegularExpression)
+		if !configuration.RegexAfterEmit {
+			f.regularExpression(f, configuration.RegularExpression, configuration.RegexTimeout, configuration.RegexDebug)
+		}
 	}
 	return f, nil
 }
 
-// Sanitize removes all nested instances of empty LineNodes for optimized marshalling
+// runPlugins runs every Plugin of Configuration on FileNode, reclassifying the lines they change if ReEmitAfterPlugin is set
+func (f *FileNode) runPlugins(ctx context.Context, configuration *Configuration) error {
+	plugins, err := configuration.Plugins()
+	if err != nil {
+		return err
+	}
+	// Line values before plugins, to find those plugins add, remove or change
+	var values map[int]string
+	if (configuration.ReEmitAfterPlugin || configuration.PluginDiff) && len(plugins) > 0 {
+		values = make(map[int]string)
+		for _, l := range f.lines() {
+			values[l.Number] = l.Value
+		}
+	}
+	err, pluginErr := f.PluginContext(ctx, &plugins)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("build cancelled: %w", ctxErr)
+	}
+	if err != nil {
+		return fmt.Errorf("could not generate intermediate file for plugin: %v", err)
+	} else if pluginErr != nil {
+		return &BuildError{
+			Message: "could not run plugins",
+			Err:     pluginErr,
+		}
+	}
+	if values != nil && configuration.PluginDiff {
+		f.PluginDiff = f.diffLines(values)
+	}
+	if values != nil && configuration.ReEmitAfterPlugin {
+		f.reclassify(values, configuration)
+	}
+	return nil
+}
+
+// diffLines returns, in line number order, the LineChange between values and the LineNode of FileNode keyed by line number
+func (f *FileNode) diffLines(values map[int]string) []*LineChange {
+	after := make(map[int]string)
+	for _, l := range f.lines() {
+		after[l.Number] = l.Value
+	}
+	var changes []*LineChange
+	for number, before := range values {
+		if value, ok := after[number]; !ok {
+			changes = append(changes, &LineChange{
+				Line:   number,
+				Change: LineRemoved,
+				Before: before,
+			})
+		} else if value != before {
+			changes = append(changes, &LineChange{
+				Line:   number,
+				Change: LineChanged,
+				Before: before,
+				After:  value,
+			})
+		}
+	}
+	for number, value := range after {
+		if _, ok := values[number]; !ok {
+			changes = append(changes, &LineChange{
+				Line:   number,
+				Change: LineAdded,
+				After:  value,
+			})
+		}
+	}
+	sort.Slice(changes, func(a, b int) bool {
+		return changes[a].Line < changes[b].Line
+	})
+	return changes
+}
+
+// configure validates the Configuration and prepares FileNode to be built from name, returning the Configuration to build with
+func (f *FileNode) configure(name string, configuration *Configuration) (*Configuration, error) {
+	if configuration == nil {
+		return nil, fmt.Errorf("could not build file: configuration is nil")
+	} else if configuration.Comment == nil {
+		comment := CommentForExtension(filepath.Ext(name))
+		if comment == nil {
+			return nil, fmt.Errorf("could not build file: configuration Comment is nil and extension %q is unknown", filepath.Ext(name))
+		}
+		configuration = configuration.clone()
+		configuration.Comment = comment
+		f.inferred = true
+	} else if configuration.Comment.Block == nil {
+		return nil, fmt.Errorf("could not build file: configuration Comment.Block is nil")
+	}
+	if configuration.NestBy != "" && configuration.NestBy != NestByIndent && configuration.NestBy != NestByKeywordDepth {
+		return nil, fmt.Errorf("could not build file: unknown nest by %v", configuration.NestBy)
+	}
+	f.Name = name
+	f.configuration = configuration
+	f.Language = configuration.Language
+	if len(f.Language) == 0 {
+		f.Language = LanguageForExtension(filepath.Ext(name))
+	}
+	return configuration, nil
+}
+
+// scan classifies and inserts each line of the provided io.Reader; flush, if set, is called after each line once no comment awaits a symbol
+func (f *FileNode) scan(ctx context.Context, r io.Reader, configuration *Configuration, flush func() error) error {
+	var regexSymbol *regexp.Regexp
+	if len(configuration.SymbolPattern) > 0 {
+		var err error
+		regexSymbol, err = regexp.Compile(configuration.SymbolPattern)
+		if err != nil {
+			return fmt.Errorf("could not compile symbol pattern: %v", err)
+		}
+	}
+	// Comment lines awaiting the symbol of the next code line
+	var symbolPending []*LineNode
+	maxLineSize := configuration.MaxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	prefix := configuration.EmitsPrefix
+	if len(prefix) == 0 {
+		prefix = DefaultEmitsPrefix
+	}
+	// Keyword depth of the last keyword line when nesting by NestByKeywordDepth
+	depth := 0
+	i := 0
+	blockStart := 0
+	// Comment line awaiting the comment line which continues its value
+	var continued *LineNode
+	// Set once exposed lines contain code, within which blank lines are expected
+	exposedCode := false
+	// add inserts the classified line; data excludes any byte order mark of length bom
+	add := func(line *LineNode, data string, offset int, bom int) error {
+		i++
+		if continued != nil && line.IsComment() && !line.IsCommentBlockStart() {
+			c := continued
+			continued = nil
+			c.Value = strings.TrimSpace(strings.TrimSuffix(c.Value, configuration.LineContinuation))
+			if len(line.Value) > 0 {
+				c.Value += " " + line.Value
+			}
+			c.CommentBlockEnd = c.CommentBlockEnd || line.CommentBlockEnd
+			if line.IsCommentBlockEnd() {
+				blockStart = 0
+			}
+			if strings.HasSuffix(c.Value, configuration.LineContinuation) {
+				continued = c
+			}
+			return nil
+		}
+		continued = nil
+		line.StartOffset = offset
+		if line.IsCommentOrExposed() {
+			line.ValueColumn += bom
+		}
+		if line.IsCommentBlockEnd() {
+			blockStart = 0
+		} else if line.IsCommentBlockStart() && blockStart == 0 {
+			blockStart = i
+		}
+		// Exposed lines, other than the comment line exposing them, should be code; blank lines within exposed code are expected
+		if line.IsExposed() && !line.CommentLine && !line.IsCode() && (len(line.Value) > 0 || !exposedCode) {
+			f.Diagnose(DiagnosticWarning, i, "exposed line is not code")
+		}
+		if !line.IsExposed() || line.CommentLine {
+			exposedCode = false
+		} else if line.IsCode() {
+			exposedCode = true
+		}
+		if regexSymbol != nil {
+			if line.IsComment() {
+				symbolPending = append(symbolPending, line)
+			} else if code := strings.TrimSpace(data); len(code) > 0 {
+				if match := regexSymbol.FindStringSubmatch(code); len(match) > 1 {
+					for _, p := range symbolPending {
+						p.Symbol = match[1]
+					}
+				}
+				symbolPending = nil
+			}
+		}
+		// Nesting by keyword depth replaces the indent; the repeated prefixes are removed so the keyword is emitted
+		if configuration.NestBy == NestByKeywordDepth {
+			if d := keywordDepth(line.Value, prefix); d > 0 && line.IsCommentOrExposed() {
+				trim := (d - 1) * len(prefix)
+				line.Value = line.Value[trim:]
+				line.ValueColumn += trim
+				line.Indent = d - 1
+				depth = d
+			} else {
+				line.Indent = depth
+			}
+		}
+		f.Insert(i, line)
+		if len(configuration.LineContinuation) > 0 && line.IsComment() && strings.HasSuffix(line.Value, configuration.LineContinuation) {
+			continued = line
+		}
+		if flush != nil && len(symbolPending) == 0 {
+			return flush()
+		}
+		return nil
+	}
+	var scanned []*scannedLine
+	parallel := false
+	// Chunks are aligned to newlines, so a custom SplitFunc is always scanned sequentially; flushing requires bounded memory, and a LineContinuation changes the preceding line
+	if configuration.ParallelChunkSize > 0 && configuration.SplitFunc == nil && flush == nil && len(configuration.LineContinuation) == 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("could not read file: %v", err)
+		}
+		scanned, parallel = classifyChunks(data, configuration, maxLineSize)
+		r = bytes.NewReader(data)
+	}
+	if parallel {
+		for _, s := range scanned {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("build cancelled: %w", err)
+			}
+			if err := add(s.line, s.data, s.offset, s.bom); err != nil {
+				return err
+			}
+		}
+	} else {
+		sc := newLineScanner(r, configuration.SplitFunc, maxLineSize)
+		offset := 0
+		for sc.Scan() {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("build cancelled: %w", err)
+			}
+			data := sc.Text()
+			bom := 0
+			if i == 0 && strings.HasPrefix(data, "\uFEFF") {
+				// UTF-8 byte order mark
+				bom = len("\uFEFF")
+				data = data[bom:]
+			}
+			if err := add(Line(f, data, configuration), data, offset, bom); err != nil {
+				return err
+			}
+			offset += sc.advance
+		}
+		if err := sc.Err(); err != nil {
+			if err == bufio.ErrTooLong {
+				return fmt.Errorf("could not scan file: line %v exceeds the maximum line size of %v bytes", i+1, maxLineSize)
+			}
+			return fmt.Errorf("could not scan file: %v", err)
+		}
+	}
+	if blockStart > 0 {
+		f.Diagnose(DiagnosticError, blockStart, "unterminated comment block")
+	}
+	return nil
+}
+
+// keywordDepth returns the number of repeated prefix preceding the keyword of value, or zero if value has no keyword
+func keywordDepth(value string, prefix string) int {
+	depth := 0
+	for strings.HasPrefix(value[depth*len(prefix):], prefix) {
+		depth++
+	}
+	rest := value[depth*len(prefix):]
+	if depth == 0 || len(rest) == 0 {
+		return 0
+	}
+	// Keywords are word characters; see EmitsRegexFormat
+	c := rest[0]
+	if c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+		return depth
+	}
+	return 0
+}
+
+// BuildAndEmit builds and emits the provided file path, returning the BuildResult
+func BuildAndEmit(path string, configuration *Configuration, meta []*MetaData) (*BuildResult, error) {
+	result := &BuildResult{
+		FileNode: &FileNode{},
+	}
+	start := time.Now()
+	_, err := result.FileNode.Build(path, configuration)
+	if err != nil {
+		return nil, err
+	}
+	result.BuildDuration = time.Since(start)
+	start = time.Now()
+	result.EmitNode, err = result.FileNode.Emit()
+	if err != nil {
+		return nil, err
+	}
+	result.EmitFile = result.EmitNode.File(path, meta)
+	result.EmitDuration = time.Since(start)
+	result.Diagnostic = result.FileNode.Diagnostic
+	return result, nil
+}
+
+// Diagnose records a Diagnostic for the provided line number
+func (f *FileNode) Diagnose(severity string, line int, format string, a ...interface{}) {
+	f.Diagnostic = append(f.Diagnostic, &Diagnostic{
+		Severity: severity,
+		Line:     line,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Walk calls fn with FileNode and each descendant in pre-order, stopping at and returning the first error
+func (f *FileNode) Walk(fn func(*FileNode) error) error {
+	if err := fn(f); err != nil {
+		return err
+	}
+	for _, c := range f.Child {
+		if err := c.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reclassify classifies each LineNode whose value differs from values by line number as Line would a source line; a LineNode left without classification becomes a comment line
+func (f *FileNode) reclassify(values map[int]string, configuration *Configuration) {
+	for _, l := range f.lines() {
+		if v, ok := values[l.Number]; ok && v == l.Value {
+			continue
+		}
+		if derived := Line(&FileNode{}, l.Value, configuration); derived.IsCommentOrExposed() {
+			l.CommentBlockStart = derived.CommentBlockStart
+			l.CommentBlockLine = derived.CommentBlockLine
+			l.CommentBlockEnd = derived.CommentBlockEnd
+			l.CommentLine = derived.CommentLine
+			l.Expose = derived.Expose
+			l.Value = derived.Value
+			continue
+		}
+		l.Value = strings.TrimSpace(l.Value)
+		if !l.IsCommentOrExposed() && len(l.Value) > 0 {
+			l.CommentLine = true
+		}
+	}
+}
+
+// lines returns every LineNode of the FileNode tree in document order
+func (f *FileNode) lines() []*LineNode {
+	var lines []*LineNode
+	if f.Line != nil {
+		lines = append(lines, f.Line)
+	}
+	for _, c := range f.Child {
+		lines = append(lines, c.lines()...)
+	}
+	return lines
+}
+
+// ValidateLineNumbers records a Diagnostic for each LineNode whose number is not greater than the one before it in document order
+func (f *FileNode) ValidateLineNumbers() {
+	previous := 0
+	for _, l := range f.lines() {
+		if l.Number <= previous {
+			f.Diagnose(DiagnosticWarning, l.Number, "line number %v is not greater than the preceding line number %v", l.Number, previous)
+		} else {
+			previous = l.Number
+		}
+	}
+}
+
+// RenumberLines repairs LineNode numbers so they increase in document order without exceeding the greatest number, or the number of lines if greater;
+// a number is kept if it is greater than the one before it and leaves room for the lines after it, otherwise it follows the one before it
+func (f *FileNode) RenumberLines() {
+	lines := f.lines()
+	last := len(lines)
+	for _, l := range lines {
+		if l.Number > last {
+			last = l.Number
+		}
+	}
+	previous := 0
+	for i, l := range lines {
+		if l.Number <= previous || l.Number > last-(len(lines)-1-i) {
+			l.Number = previous + 1
+		}
+		previous = l.Number
+	}
+}
+
+// Sanitize removes all nested instances of empty LineNodes for optimized marshalling; blank exposed lines are removed unless Configuration.PreserveExposedWhitespace
 func (f *FileNode) Sanitize() {
-	for i, c := range f.Child {
-		if !c.HasCommentOrExposedLine() {
-			if i < len(f.Child) {
-				f.Child = append(f.Child[:i], f.Child[i+1:]...)
+	f.sanitize(f.configuration != nil && f.configuration.PreserveExposedWhitespace)
+}
+
+// sanitize is Sanitize which retains blank exposed lines if whitespace is preserved
+func (f *FileNode) sanitize(whitespace bool) {
+	f.insertion = nil
+	if len(f.Child) == 0 {
+		return
+	}
+	child := make([]*FileNode, 0, len(f.Child))
+	for i := 0; i < len(f.Child); i++ {
+		c := f.Child[i]
+		// A removed blank line is replaced by the lines nested beneath it
+		if !whitespace && c.Line.IsExposed() && !c.Line.IsComment() && len(c.Line.Value) == 0 {
+			for _, n := range c.Child {
+				n.Parent = f
 			}
-			c.FirstNode().Sanitize()
+			f.Child = append(f.Child[:i+1:i+1], append(c.Child, f.Child[i+1:]...)...)
+			continue
 		}
-		c.Sanitize()
+		if c.HasCommentOrExposedLine() {
+			c.sanitize(whitespace)
+			child = append(child, c)
+		}
+	}
+	if len(child) == 0 {
+		child = nil
 	}
+	f.Child = child
 }
 
 // HasCommentOrExposedLine returns true if FileNode satisfies IsCommentOrExposed criteria
@@ -233,54 +1135,363 @@ func (f *FileNode) HasCommentOrExposedLine() bool {
 
 // CompileRegularExpressions caches the expression compilation before use; returns all known errors
 func (c *Configuration) CompileRegularExpressions() error {
-	var errors []string
+	var errors []error
 	r := *c.RegularExpression
 	for i, e := range r {
-		object, err := regexp.Compile(e.Find)
+		object, err := regexp.Compile(e.pattern())
 		if err != nil {
-			errors = append(errors, err.Error())
+			errors = append(errors, err)
+		} else if e.Scope != "" && e.Scope != ScopeAll && e.Scope != ScopeComment && e.Scope != ScopeExposed {
+			errors = append(errors, fmt.Errorf("unknown scope %v", e.Scope))
 		} else {
 			r[i].Compiled = object
 		}
 	}
 	if len(errors) > 0 {
-		return fmt.Errorf("could not compile regular expression: %v", strings.Join(errors, ", "))
+		return &BuildError{
+			Message: "could not compile regular expression",
+			Err:     errors,
+		}
 	}
 	return nil
 }
 
-// LastNode returns the last FileNode of the last FileNode.Child
-func (f *FileNode) LastNode() *FileNode {
-	if f.Child != nil {
-		return f.Child[len(f.Child)-1].LastNode()
-	}
-	return f
-}
-
-// FirstNode returns the first FileNode of the FileNode tree
-func (f *FileNode) FirstNode() *FileNode {
-	if f.Parent != nil {
-		return f.Parent.FirstNode()
+// compileRegularExpressions is CompileRegularExpressions which first enforces MaxRegexCount
+func (c *Configuration) compileRegularExpressions() error {
+	if c.MaxRegexCount > 0 && len(*c.RegularExpression) > c.MaxRegexCount {
+		return fmt.Errorf("could not compile regular expression: %v expressions exceed the maximum of %v", len(*c.RegularExpression), c.MaxRegexCount)
 	}
-	return f
+	return c.CompileRegularExpressions()
 }
 
-// LastIndent returns the last FileNode with the provided indent, or the last FileNode if not found
-func (f *FileNode) LastIndent(indent int) *FileNode {
-	if f.Line != nil {
-		if f.Line.Indent == indent {
-			return f
+// Validate returns all known problems with Configuration: missing comment tokens, equal CommentBlock tokens unless Symmetric, missing or non-executable plugins and invalid regular expressions
+func (c *Configuration) Validate() error {
+	var errors []string
+	if c.Comment == nil {
+		errors = append(errors, "comment is nil")
+	} else {
+		if c.Comment.Block == nil {
+			errors = append(errors, "comment block is nil")
+		} else if len(c.Comment.Block.Start) == 0 && len(c.Comment.Block.End) == 0 {
+			// A disabled comment block requires a comment line
+			if len(c.Comment.Line) == 0 {
+				errors = append(errors, "comment line and block are empty")
+			}
+		} else {
+			if len(c.Comment.Block.Start) == 0 {
+				errors = append(errors, "comment block start is empty")
+			}
+			if len(c.Comment.Block.End) == 0 {
+				errors = append(errors, "comment block end is empty")
+			}
+			if c.Comment.Block.Start == c.Comment.Block.End && !c.Comment.Block.Symmetric {
+				errors = append(errors, fmt.Sprintf("comment block start and end are both %q", c.Comment.Block.Start))
+			}
 		}
-		if f.Parent != nil {
-			return f.Parent.LastIndent(indent)
+	}
+	plugins, err := c.Plugins()
+	if err != nil {
+		errors = append(errors, err.Error())
+	}
+	for _, p := range plugins {
+		info, err := os.Stat(p.Path)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("plugin %v: %v", p.Path, err))
+		} else if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			errors = append(errors, fmt.Sprintf("plugin %v is not executable", p.Path))
+		}
+	}
+	if c.RegularExpression != nil {
+		if c.MaxRegexCount > 0 && len(*c.RegularExpression) > c.MaxRegexCount {
+			errors = append(errors, fmt.Sprintf("%v regular expressions exceed the maximum of %v", len(*c.RegularExpression), c.MaxRegexCount))
+		}
+		for _, r := range *c.RegularExpression {
+			if _, err := regexp.Compile(r.pattern()); err != nil {
+				errors = append(errors, err.Error())
+			}
+			if r.Scope != "" && r.Scope != ScopeAll && r.Scope != ScopeComment && r.Scope != ScopeExposed {
+				errors = append(errors, fmt.Sprintf("unknown scope %v", r.Scope))
+			}
+		}
+	}
+	if _, err := duplicateFlags(nil, c.FlagDuplicatePolicy); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if c.NestBy != "" && c.NestBy != NestByIndent && c.NestBy != NestByKeywordDepth {
+		errors = append(errors, fmt.Sprintf("unknown nest by %v", c.NestBy))
+	}
+	for _, pattern := range []string{c.LineTagPattern, c.SymbolPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("could not validate configuration: %v", strings.Join(errors, ", "))
+	}
+	return nil
+}
+
+// DefaultConfiguration returns a Configuration with C-style comments and Expose enabled
+func DefaultConfiguration() *Configuration {
+	return &Configuration{
+		Expose: true,
+		Comment: &Comment{
+			Line: "//",
+			Block: &CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		EmitsPrefix: DefaultEmitsPrefix,
+	}
+}
+
+// PresetConfiguration returns DefaultConfiguration with the comment tokens of the provided language
+func PresetConfiguration(language string) (*Configuration, error) {
+	comment, ok := languageComment[strings.ToLower(language)]
+	if !ok {
+		supported := make([]string, 0, len(languageComment))
+		for l := range languageComment {
+			supported = append(supported, l)
+		}
+		sort.Strings(supported)
+		return nil, fmt.Errorf("could not find preset for language %v; supported languages are %v", language, strings.Join(supported, ", "))
+	}
+	block := *comment.Block
+	comment.Block = &block
+	c := DefaultConfiguration()
+	c.Language = strings.ToLower(language)
+	c.Comment = &comment
+	return c, nil
+}
+
+// GoConfiguration returns DefaultConfiguration for the go language
+func GoConfiguration() *Configuration {
+	c := DefaultConfiguration()
+	c.Language = "go"
+	return c
+}
+
+// JavaScriptConfiguration returns DefaultConfiguration for the javascript language
+func JavaScriptConfiguration() *Configuration {
+	c := DefaultConfiguration()
+	c.Language = "javascript"
+	return c
+}
+
+// pluginPath returns path, when relative, as an absolute path within PluginWorkingDir; otherwise path is unchanged
+func (c *Configuration) pluginPath(path string) string {
+	if c == nil || len(c.PluginWorkingDir) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+	abs, err := filepath.Abs(filepath.Join(c.PluginWorkingDir, path))
+	if err != nil {
+		return filepath.Join(c.PluginWorkingDir, path)
+	}
+	return abs
+}
+
+// Plugins returns every Plugin in execution order: Plugin in slice order, then the executable files of each PluginDirectory, in slice order, sorted lexically by name; relative paths are resolved against PluginWorkingDir
+func (c *Configuration) Plugins() ([]Plugin, error) {
+	var plugins []Plugin
+	if c.Plugin != nil {
+		plugins = append(plugins, *c.Plugin...)
+	}
+	for i := range plugins {
+		plugins[i].Path = c.pluginPath(plugins[i].Path)
+	}
+	for _, dir := range c.PluginDirectory {
+		dir = c.pluginPath(dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not read plugin directory: %v", err)
+		}
+		// os.ReadDir sorts entries by file name
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			// os.Stat follows symbolic links to executables, skipping those which are broken
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("could not read plugin directory: %v", err)
+			}
+			if info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+				plugins = append(plugins, Plugin{
+					Path: path,
+				})
+			}
+		}
+	}
+	return plugins, nil
+}
+
+// Matches returns true if the provided slash separated path matches any Include, or Include is empty, and does not match any Exclude; see matchGlob
+func (c *Configuration) Matches(path string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if matchGlob(p, path) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(c.Include) == 0 || match(c.Include)) && !match(c.Exclude)
+}
+
+// matchGlob returns true if path matches the filepath.Match pattern, where a ** segment matches zero or more directories; a pattern without a slash matches the base name
+func matchGlob(pattern string, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+	var match func(p []string, s []string) bool
+	match = func(p []string, s []string) bool {
+		if len(p) == 0 {
+			return len(s) == 0
+		}
+		if p[0] == "**" {
+			for i := 0; i <= len(s); i++ {
+				if match(p[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(s) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(p[0], s[0]); !ok {
+			return false
+		}
+		return match(p[1:], s[1:])
+	}
+	return match(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+// clone returns a copy of Configuration whose RegularExpression may be compiled without affecting the original, or nil if Configuration is nil
+func (c *Configuration) clone() *Configuration {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	if c.RegularExpression != nil {
+		r := append([]RegularExpression(nil), *c.RegularExpression...)
+		clone.RegularExpression = &r
+	}
+	return &clone
+}
+
+// Reset zeroes FileNode so it may be built again; FileNode must not be in use elsewhere, and any Child kept from before Reset still reference it as Parent
+func (f *FileNode) Reset() {
+	*f = FileNode{}
+}
+
+// LastNode returns the last FileNode of the last FileNode.Child
+func (f *FileNode) LastNode() *FileNode {
+	if f.insertion.valid(f) {
+		if len(f.insertion.path) == 0 {
+			return f
+		}
+		return f.insertion.path[len(f.insertion.path)-1]
+	}
+	if f.Child != nil {
+		return f.Child[len(f.Child)-1].LastNode()
+	}
+	return f
+}
+
+// FirstNode returns the first FileNode of the FileNode tree
+func (f *FileNode) FirstNode() *FileNode {
+	if f.Parent != nil {
+		return f.Parent.FirstNode()
+	}
+	return f
+}
+
+// Address returns the slash joined Child indexes from the first FileNode to FileNode, e.g. 0/2/1; the first FileNode is addressed by an empty string
+func (f *FileNode) Address() string {
+	if f.Parent == nil {
+		return ""
+	}
+	for i, c := range f.Parent.Child {
+		if c == f {
+			if address := f.Parent.Address(); len(address) > 0 {
+				return address + "/" + strconv.Itoa(i)
+			}
+			return strconv.Itoa(i)
+		}
+	}
+	return ""
+}
+
+// NodeAt returns the FileNode at the provided Address within the FileNode tree, or nil if not found
+func (f *FileNode) NodeAt(address string) *FileNode {
+	node := f.FirstNode()
+	if len(address) == 0 {
+		return node
+	}
+	for _, segment := range strings.Split(address, "/") {
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(node.Child) {
+			return nil
+		}
+		node = node.Child[i]
+	}
+	return node
+}
+
+// validate returns an error describing the first descendant FileNode without a LineNode, with a line number below one, or whose ParentLine is not the line number of its Parent
+func (f *FileNode) validate() error {
+	if f.Parent == nil && f.Line != nil {
+		return fmt.Errorf("file has line %v", f.Line.Number)
+	}
+	for _, c := range f.Child {
+		if c.Line == nil {
+			return fmt.Errorf("node %v has no line", c.Address())
+		}
+		if c.Line.Number < 1 {
+			return fmt.Errorf("node %v has line number %v", c.Address(), c.Line.Number)
+		}
+		parent := 0
+		if f.Line != nil {
+			parent = f.Line.Number
+		}
+		if c.ParentLine != 0 && c.ParentLine != parent {
+			return fmt.Errorf("line %v has parent %v, expected %v", c.Line.Number, c.ParentLine, parent)
+		}
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RelinkParents sets the Parent of each Child, which is not preserved by JSON, so a decoded FileNode tree is navigable
+func (f *FileNode) RelinkParents() {
+	f.insertion = nil
+	for _, c := range f.Child {
+		c.Parent = f
+		c.RelinkParents()
+	}
+}
+
+// LastIndent returns the last FileNode with the provided indent, or the last FileNode if not found
+func (f *FileNode) LastIndent(indent int) *FileNode {
+	if f.Line != nil {
+		if f.Line.Indent == indent {
+			return f
+		}
+		if f.Parent != nil {
+			return f.Parent.LastIndent(indent)
 		}
 	}
 	return nil
 }
 
-// IsCommentWithinBlock returns true if FileNode satisfies CommentBlock criteria
+// IsCommentWithinBlock returns true if FileNode satisfies CommentBlock criteria: Line is within an open CommentBlock, or the LastNode starts one
 func (f *FileNode) IsCommentWithinBlock() bool {
-	return !f.LastNode().Line.IsCommentBlockEnd() && f.LastNode().Line.IsCommentBlockStart()
+	return f.withinBlock || !f.LastNode().Line.IsCommentBlockEnd() && f.LastNode().Line.IsCommentBlockStart()
 }
 
 // IsExposedWithinBlock returns true if FileNode satisfies Comment and EXPOSE criteria
@@ -290,6 +1501,10 @@ func (f *FileNode) IsExposedWithinBlock() bool {
 
 // Insert returns a FileNode based on the provided line number and LineNode
 func (f *FileNode) Insert(lineNumber int, lineNode *LineNode) *FileNode {
+	if f.Line == nil && f.Parent == nil {
+		f.insert(lineNumber, lineNode)
+		return f
+	}
 	lastNode := f.LastNode()
 	lineNode.Number = lineNumber
 	if lastNode.Line == nil || lineNode.Indent == lastNode.Line.Indent {
@@ -326,18 +1541,118 @@ func (f *FileNode) Insert(lineNumber int, lineNode *LineNode) *FileNode {
 	return f
 }
 
+// insert places the LineNode within the first FileNode using the insertion path, matching Insert in amortized constant time
+func (f *FileNode) insert(lineNumber int, lineNode *LineNode) {
+	if !f.insertion.valid(f) {
+		f.insertion = newInsertion(f)
+	}
+	s := f.insertion
+	lineNode.Number = lineNumber
+	parent, depth := f, 0
+	if n := len(s.path); n > 0 {
+		last := s.path[n-1]
+		parent, depth = last, n
+		if lineNode.Indent == last.Line.Indent {
+			parent, depth = last.Parent, n-1
+		} else if lineNode.Indent < last.Line.Indent {
+			if positions := s.indent[lineNode.Indent]; len(positions) > 0 {
+				p := positions[len(positions)-1]
+				parent, depth = s.path[p].Parent, p
+			}
+		}
+	}
+	node := &FileNode{
+		Line:   lineNode,
+		Parent: parent,
+	}
+	parent.Child = append(parent.Child, node)
+	s.truncate(depth)
+	s.push(node)
+}
+
+// newInsertion returns the insertion path from the first FileNode to its LastNode
+func newInsertion(f *FileNode) *insertion {
+	s := &insertion{
+		indent: make(map[int][]int),
+	}
+	for node := f; len(node.Child) > 0; {
+		node = node.Child[len(node.Child)-1]
+		s.push(node)
+	}
+	return s
+}
+
+// valid returns true if the insertion path still ends at the LastNode of the first FileNode
+func (s *insertion) valid(f *FileNode) bool {
+	if s == nil {
+		return false
+	}
+	if len(s.path) == 0 {
+		return len(f.Child) == 0
+	}
+	first, last := s.path[0], s.path[len(s.path)-1]
+	return len(f.Child) > 0 && f.Child[len(f.Child)-1] == first && first.Parent == f &&
+		len(last.Child) == 0 && last.Parent.Child[len(last.Parent.Child)-1] == last
+}
+
+// push appends the FileNode to the insertion path
+func (s *insertion) push(node *FileNode) {
+	if node.Line != nil {
+		s.indent[node.Line.Indent] = append(s.indent[node.Line.Indent], len(s.path))
+	}
+	s.path = append(s.path, node)
+}
+
+// truncate removes every FileNode from the insertion path beyond depth
+func (s *insertion) truncate(depth int) {
+	for len(s.path) > depth {
+		node := s.path[len(s.path)-1]
+		if node.Line != nil {
+			positions := s.indent[node.Line.Indent]
+			s.indent[node.Line.Indent] = positions[:len(positions)-1]
+		}
+		s.path = s.path[:len(s.path)-1]
+	}
+}
+
 // Plugin returns updated FileNode after processing Plugin array
 func (f *FileNode) Plugin(plugins *[]Plugin) (intermediateError error, pluginErrors []error) {
+	return f.PluginContext(context.Background(), plugins)
+}
+
+// PluginContext is Plugin which stops running Plugin executables when the provided context.Context is done
+func (f *FileNode) PluginContext(ctx context.Context, plugins *[]Plugin) (intermediateError error, pluginErrors []error) {
 	// Generate an intermediate file for any external executable to consume
-	out := fmt.Sprintf("_temp.%v.json", time.Now().Nanosecond())
-	err := f.Write(out)
+	dir := "."
+	if f.configuration != nil && len(f.configuration.PluginWorkingDir) > 0 {
+		dir = f.configuration.PluginWorkingDir
+	}
+	temp, err := os.CreateTemp(dir, "_temp.*.json")
+	if err != nil {
+		return err, nil
+	}
+	out := temp.Name()
+	limit := DefaultMaxPluginOutputBytes
+	if f.configuration != nil && f.configuration.MaxPluginOutputBytes > 0 {
+		limit = f.configuration.MaxPluginOutputBytes
+	}
+	err = temp.Close()
+	if err != nil {
+		return err, nil
+	}
+	err = f.Write(out)
 	if err != nil {
 		return err, nil
 	}
 	if plugins != nil {
 		for _, run := range *plugins {
+			if ctx.Err() != nil {
+				break
+			}
 			pluginError := func() error {
-				cmd := exec.Command(run.Path, out)
+				// The intermediate file is within the plugin working directory
+				cmd := exec.CommandContext(ctx, f.configuration.pluginPath(run.Path), filepath.Base(out))
+				cmd.Dir = dir
 				err := cmd.Start()
 				if err != nil {
 					return err
@@ -350,22 +1665,35 @@ func (f *FileNode) Plugin(plugins *[]Plugin) (intermediateError error, pluginErr
 				if err != nil {
 					return err
 				}
-				defer func(jsonFile *os.File) {
-					err := jsonFile.Close()
-					if err != nil {
-					}
-				}(jsonFile)
-				byteValue, err := ioutil.ReadAll(jsonFile)
+				// One byte beyond the limit distinguishes output at the limit from output exceeding it
+				byteValue, err := io.ReadAll(io.LimitReader(jsonFile, int64(limit)+1))
+				closeErr := jsonFile.Close()
 				if err != nil {
 					return err
 				}
-				if json.Unmarshal(byteValue, &f) != nil {
-					return err
+				if closeErr != nil {
+					return closeErr
 				}
+				if len(byteValue) > limit {
+					return fmt.Errorf("could not read intermediate file: output exceeds the maximum of %v bytes", limit)
+				}
+				// Decode separately so a broken intermediate file leaves FileNode unchanged
+				decoded := &FileNode{}
+				err = json.Unmarshal(byteValue, decoded)
+				if err != nil {
+					return fmt.Errorf("could not read intermediate file: %v", err)
+				}
+				decoded.RelinkParents()
+				err = decoded.validate()
+				if err != nil {
+					return fmt.Errorf("could not validate intermediate file: %v", err)
+				}
+				f.Child = decoded.Child
+				f.RelinkParents()
 				return nil
 			}()
 			if pluginError != nil {
-				pluginErrors = append(pluginErrors, pluginError)
+				pluginErrors = append(pluginErrors, fmt.Errorf("%v: %w", run.Path, pluginError))
 			}
 		}
 	}
@@ -378,15 +1706,30 @@ func (f *FileNode) Plugin(plugins *[]Plugin) (intermediateError error, pluginErr
 
 // RegularExpression returns updated FileNode after processing RegularExpression array
 func (f *FileNode) RegularExpression(r *[]RegularExpression) {
+	f.regularExpression(f, r, 0, false)
+}
+
+// regularExpression is RegularExpression which skips, and records a Diagnostic on root for, each replacement exceeding a positive timeout; debug records LineNode.Modified
+func (f *FileNode) regularExpression(root *FileNode, r *[]RegularExpression, timeout time.Duration, debug bool) {
 	if f.Line != nil {
 		if len(f.Line.Value) > 0 {
-			for _, e := range *r {
-				f.Line.Value = e.Compiled.ReplaceAllString(f.Line.Value, e.Replace)
+			for i, e := range *r {
+				if !e.applies(f.Line) {
+					continue
+				}
+				value, ok := e.replaceWithin(f.Line.Value, timeout)
+				if !ok {
+					root.Diagnose(DiagnosticWarning, f.Line.Number, "regular expression %v exceeded %v", e.Find, timeout)
+				}
+				if debug && value != f.Line.Value {
+					f.Line.Modified = append(f.Line.Modified, i)
+				}
+				f.Line.Value = value
 			}
 		}
 	}
 	for _, c := range f.Child {
-		c.RegularExpression(r)
+		c.regularExpression(root, r, timeout, debug)
 	}
 }
 
@@ -422,6 +1765,11 @@ func (l *LineNode) IsExposed() bool {
 	return l.Expose
 }
 
+// IsCode returns true if LineNode is not a comment and has a value
+func (l *LineNode) IsCode() bool {
+	return !l.IsComment() && len(l.Value) > 0
+}
+
 // IsCommentOrExposed returns true if IsComment or IsExposed
 func (l *LineNode) IsCommentOrExposed() bool {
 	return l.IsComment() || l.IsExposed()
@@ -429,88 +1777,1051 @@ func (l *LineNode) IsCommentOrExposed() bool {
 
 // Write generates and saves the FileNode to disk for use by plugins
 func (f *FileNode) Write(path string) error {
+	return writeFile(path, f)
+}
+
+// WriteTo encodes the FileNode to the provided io.Writer, returning the number of bytes written
+func (f *FileNode) WriteTo(w io.Writer) (int64, error) {
 	data, err := json.Marshal(f)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// writerToFunc adapts a function to io.WriterTo
+type writerToFunc func(w io.Writer) (int64, error)
+
+// WriteTo calls the writerToFunc
+func (fn writerToFunc) WriteTo(w io.Writer) (int64, error) {
+	return fn(w)
+}
+
+// writeFile creates or truncates the provided path and writes data to it, gzip compressed if path has GzipExtension
+func writeFile(path string, data io.WriterTo) error {
+	if strings.HasSuffix(path, GzipExtension) {
+		return openFile(path, os.O_TRUNC, writerToFunc(func(w io.Writer) (int64, error) {
+			gz := gzip.NewWriter(w)
+			n, err := data.WriteTo(gz)
+			closeErr := gz.Close()
+			if err != nil {
+				return n, err
+			}
+			return n, closeErr
+		}))
+	}
+	return openFile(path, os.O_TRUNC, data)
+}
+
+// openFile opens path for writing with the provided flag, creating it if needed, and writes data to it
+func openFile(path string, flag int, data io.WriterTo) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(path, data, 0644)
+	_, err = data.WriteTo(file)
+	closeErr := file.Close()
 	if err != nil {
 		return err
 	}
-	return nil
+	return closeErr
 }
 
-// Emit returns EmitNode from FileNode
+// Emit returns EmitNode from FileNode; the Diagnostic recorded by any previous Emit are replaced by those of this one
 func (f *FileNode) Emit() (*EmitNode, error) {
-	regexEmits, err := regexp.Compile(EmitsRegex)
+	if !f.emitted {
+		f.emitted, f.diagnosed = true, len(f.Diagnostic)
+	}
+	f.Diagnostic = f.Diagnostic[:f.diagnosed:f.diagnosed]
+	path, err := filepath.Abs(f.Name)
 	if err != nil {
-		return nil, err
+		path = f.Name
 	}
-	regexFlag, err := regexp.Compile(EmitsFlagRegex)
+	return f.emit([]string{path})
+}
+
+// emit is Emit within the provided chain of included file paths, beginning with the first file and ending with FileNode
+func (f *FileNode) emit(included []string) (*EmitNode, error) {
+	configuration := f.configuration
+	if configuration == nil {
+		configuration = &Configuration{}
+	}
+	em, err := newEmitter(configuration, f.Name)
 	if err != nil {
 		return nil, err
 	}
-	emits, err := f.Process(regexEmits, regexFlag)
+	em.root = f
+	emits, err := f.process(em, nil)
 	if err != nil {
 		return nil, err
 	}
+	if len(configuration.IncludeKeyword) > 0 {
+		f.include(emits, configuration, included)
+	}
+	if len(configuration.MinSeverity) > 0 {
+		order := configuration.SeverityOrder
+		if len(order) == 0 {
+			order = DefaultSeverityOrder
+		}
+		err = emits.FilterSeverity(configuration.MinSeverity, order)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.Schema != nil {
+		f.Diagnostic = append(f.Diagnostic, emits.Validate(configuration.Schema)...)
+	}
+	emits.Meta = &EmitMeta{
+		File:     f.Name,
+		Language: f.Language,
+	}
+	emits.now = configuration.Now
+	if len(configuration.MetaKeyword) > 0 {
+		emits.Meta.Data = emits.hoist(configuration.MetaKeyword)
+	}
+	if len(configuration.PrimaryKeyword) > 0 {
+		primary := emits.promote(configuration.PrimaryKeyword)
+		if len(primary) > 0 {
+			emits.Meta.Title = primary[0].Value
+			for _, p := range primary[1:] {
+				f.Diagnose(DiagnosticWarning, p.Line, "duplicate primary keyword %v; first defined on line %v", p.Keyword, primary[0].Line)
+			}
+		}
+	}
+	if len(configuration.RootKeyword) > 0 {
+		root := &EmitNode{
+			Keyword: configuration.RootKeyword,
+			Flag: []*EmitFlag{
+				{
+					Name:  FileFlag,
+					Value: f.Name,
+				},
+			},
+			Data: emits.Data,
+		}
+		if len(root.Data) > 0 {
+			root.Line = root.Data[0].Line
+			root.LineStart = root.Data[0].LineStart
+			root.LineEnd = root.Data[len(root.Data)-1].LineEnd
+		}
+		emits.Data = []*EmitNode{root}
+	}
+	if configuration.EmitEmptyArrays {
+		emits.markEmptyArrays()
+	}
 	return emits, nil
 }
 
+// markEmptyArrays marshals empty flag and data arrays of the EmitNode tree rather than omitting them
+func (e *EmitNode) markEmptyArrays() {
+	e.emptyArrays = true
+	for _, d := range e.Data {
+		d.markEmptyArrays()
+	}
+}
+
+// emitsFlagRegex is EmitsFlagRegex which allows a flag name to escape its colons and a flag value to be empty
+const emitsFlagRegex = "^((?:\\\\.|[^\\\\:])+):(.*)"
+
+// newEmitter returns the emitter of the provided Configuration and file name
+func newEmitter(configuration *Configuration, file string) (*emitter, error) {
+	prefix := configuration.EmitsPrefix
+	if len(prefix) == 0 {
+		prefix = DefaultEmitsPrefix
+	}
+	regexEmits, err := regexp.Compile(fmt.Sprintf(EmitsRegexFormat, regexp.QuoteMeta(prefix)))
+	if err != nil {
+		return nil, err
+	}
+	regexFlag, err := regexp.Compile(emitsFlagRegex)
+	if err != nil {
+		return nil, err
+	}
+	em := &emitter{
+		configuration: configuration,
+		file:          file,
+		regexEmits:    regexEmits,
+		regexFlag:     regexFlag,
+	}
+	if len(configuration.LineTagPattern) > 0 {
+		em.regexTag, err = regexp.Compile(configuration.LineTagPattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile line tag pattern: %v", err)
+		}
+	}
+	return em, nil
+}
+
+// hoist removes every top level Data with the provided keyword and returns each as MetaData keyed by the first word of its value
+func (e *EmitNode) hoist(keyword string) []*MetaData {
+	var meta []*MetaData
+	data := make([]*EmitNode, 0, len(e.Data))
+	for _, d := range e.Data {
+		if d.Keyword != keyword {
+			data = append(data, d)
+			continue
+		}
+		field := strings.SplitN(strings.TrimSpace(d.Value), " ", 2)
+		m := &MetaData{
+			Keyword: field[0],
+		}
+		if len(field) > 1 {
+			m.Value = strings.TrimSpace(field[1])
+		}
+		meta = append(meta, m)
+	}
+	e.Data = data
+	return meta
+}
+
+// include attaches the Data of the file referenced by each Configuration.IncludeKeyword EmitNode, by PathFlag or value relative to FileNode, recording a Diagnostic for each cycle or failure;
+// an included file infers its own Comment if FileNode inferred Comment
+func (f *FileNode) include(e *EmitNode, configuration *Configuration, included []string) {
+	for _, d := range e.Data {
+		if d.Keyword != configuration.IncludeKeyword {
+			f.include(d, configuration, included)
+			continue
+		}
+		path := d.Value
+		for _, flag := range d.Flag {
+			if flag.Name == PathFlag {
+				path = flag.Value
+			}
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(f.Name), path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		cycle := false
+		for _, i := range included {
+			cycle = cycle || i == abs
+		}
+		if cycle {
+			f.Diagnose(DiagnosticError, d.Line, "include cycle: %v", path)
+			continue
+		}
+		child := &FileNode{}
+		childConfiguration := configuration.clone()
+		if f.inferred {
+			childConfiguration.Comment = nil
+		}
+		_, err = child.Build(path, childConfiguration)
+		if err != nil {
+			f.Diagnose(DiagnosticError, d.Line, "could not include %v: %v", path, err)
+			continue
+		}
+		emits, err := child.emit(append(included[:len(included):len(included)], abs))
+		if err != nil {
+			f.Diagnose(DiagnosticError, d.Line, "could not include %v: %v", path, err)
+			continue
+		}
+		for _, c := range child.Diagnostic {
+			f.Diagnose(c.Severity, d.Line, "%v:%v: %v", path, c.Line, c.Message)
+		}
+		d.Data = append(d.Data, emits.Data...)
+	}
+}
+
+// promote removes the first Data with the provided keyword, replacing it with its own Data, and returns every Data with the keyword in document order
+func (e *EmitNode) promote(keyword string) []*EmitNode {
+	var found []*EmitNode
+	var walk func(n *EmitNode)
+	walk = func(n *EmitNode) {
+		data := make([]*EmitNode, 0, len(n.Data))
+		for _, d := range n.Data {
+			first := len(found) == 0 && d.Keyword == keyword
+			if d.Keyword == keyword {
+				found = append(found, d)
+			}
+			walk(d)
+			if first {
+				data = append(data, d.Data...)
+			} else {
+				data = append(data, d)
+			}
+		}
+		n.Data = data
+	}
+	walk(e)
+	return found
+}
+
 // Process returns EmitNode based on LineNode.Value
 func (f *FileNode) Process(regexEmits *regexp.Regexp, regexFlag *regexp.Regexp) (*EmitNode, error) {
+	configuration := f.configuration
+	if configuration == nil {
+		configuration = &Configuration{}
+	}
+	return f.process(&emitter{
+		configuration: configuration,
+		file:          f.Name,
+		regexEmits:    regexEmits,
+		regexFlag:     regexFlag,
+	}, nil)
+}
+
+// process returns EmitNode based on LineNode.Value using the provided emitter and the inherited flags of its ancestors
+func (f *FileNode) process(em *emitter, inherited map[string]string) (*EmitNode, error) {
 	e := &EmitNode{}
 	if f.Line != nil {
 		e.Line = f.Line.Number
+		e.LineStart = f.Line.Number
+		e.LineEnd = f.Line.Number
 		e.Value = f.Line.Value
-		match := regexEmits.FindStringSubmatch(f.Line.Value)
+		match := em.regexEmits.FindStringSubmatch(f.Line.Value)
 		if len(match) > 0 {
 			e.Value = match[4]
 			e.Keyword = match[1]
 			if len(match[3]) > 0 {
-				flags := strings.Split(match[3], FlagSplit)
-				if len(flags) > 0 {
-					for _, flag := range flags {
-						flagData := &EmitFlag{}
-						flagMatch := regexFlag.FindStringSubmatch(flag)
-						if len(flagMatch) > 0 {
-							flagData.Name = flagMatch[1]
-							flagData.Value = flagMatch[2]
-						} else {
-							flagData.Value = flag
-						}
-						e.Flag = append(e.Flag, flagData)
+				e.Flag = em.parseFlags(match[3])
+				flags, err := duplicateFlags(e.Flag, em.configuration.FlagDuplicatePolicy)
+				if err != nil {
+					return nil, fmt.Errorf("could not process line %v: %v", e.Line, err)
+				}
+				e.Flag = flags
+			}
+		}
+		// Regular Expressions (after the keyword and flags are parsed)
+		if em.configuration.RegexAfterEmit && em.configuration.RegularExpression != nil && len(e.Value) > 0 {
+			// Modified is recorded by each Emit rather than appended to
+			var modified []int
+			for i, r := range *em.configuration.RegularExpression {
+				if r.Compiled != nil && r.applies(f.Line) {
+					value, ok := r.replaceWithin(e.Value, em.configuration.RegexTimeout)
+					if !ok {
+						em.root.Diagnose(DiagnosticWarning, f.Line.Number, "regular expression %v exceeded %v", r.Find, em.configuration.RegexTimeout)
 					}
+					if value != e.Value {
+						modified = append(modified, i)
+					}
+					e.Value = value
 				}
 			}
+			if em.configuration.RegexDebug {
+				f.Line.Modified = modified
+			}
+		}
+		if len(f.Line.Symbol) > 0 && len(e.Keyword) > 0 {
+			e.Flag = append(e.Flag, &EmitFlag{
+				Name:  SymbolFlag,
+				Value: f.Line.Symbol,
+			})
+		}
+		if em.configuration.SplitValues && len(e.Keyword) > 0 {
+			e.Values = splitValues(e.Value)
+		}
+		// Inherited Flags
+		if len(e.Keyword) > 0 && len(em.configuration.InheritFlags) > 0 {
+			inherited = e.inherit(inherited, em.configuration.InheritFlags)
+		}
+		if em.configuration.SortFlags {
+			sort.SliceStable(e.Flag, func(a, b int) bool {
+				return e.Flag[a].Name < e.Flag[b].Name
+			})
+		}
+		// Tags
+		if em.regexTag != nil && f.Line.IsComment() {
+			for _, tag := range em.regexTag.FindAllStringSubmatch(f.Line.Value, -1) {
+				e.Tag = append(e.Tag, tag[len(tag)-1])
+			}
+		}
+		e.sourceLine = em.configuration.EmitSourceLine
+		if em.configuration.EmitSourceFile {
+			e.sourceFile = em.file
+		}
+		if em.configuration.EmitContentHash && len(e.Keyword) > 0 {
+			e.ContentHash = e.Hash()
 		}
 	}
-	for _, c := range f.Child {
-		n, err := c.Process(regexEmits, regexFlag)
+	for i := 0; i < len(f.Child); i++ {
+		c := f.Child[i]
+		var n *EmitNode
+		var err error
+		if em.configuration.ExposeBlock && c.Line.IsComment() && c.Line.IsExposed() {
+			// Exposed code may follow as siblings at the same indent
+			j := i + 1
+			for j < len(f.Child) && f.Child[j].isExposedCode() {
+				j++
+			}
+			n, err = c.processExposed(em, inherited, f.Child[i+1:j])
+			i = j - 1
+		} else {
+			n, err = c.process(em, inherited)
+		}
 		if err != nil {
 			return nil, err
 		} else {
 			e.Data = append(e.Data, n)
 		}
+		if e.LineStart > 0 && n.LineEnd > e.LineEnd {
+			e.LineEnd = n.LineEnd
+		}
+	}
+	if em.configuration.Coalesce && len(e.Keyword) > 0 {
+		join := em.configuration.ValueJoin
+		if len(join) == 0 {
+			join = DefaultValueJoin
+		}
+		e.Coalesce(join)
 	}
 	return e, nil
 }
 
-// Write generates and saves the EmitNode to disk
-func (e *EmitNode) Write(inputPath string, outputPath string, meta []*MetaData) error {
+// parseFlags returns the EmitFlag of the provided flags; with NestedFlags, a brace delimited value is parsed into EmitFlag.Flag
+func (em *emitter) parseFlags(flags string) []*EmitFlag {
+	delimiter := em.configuration.FlagSplit
+	if len(delimiter) == 0 {
+		delimiter = FlagSplit
+	}
+	var parsed []*EmitFlag
+	for _, flag := range splitFlags(flags, delimiter, em.configuration.NestedFlags) {
+		flagData := &EmitFlag{}
+		flagMatch := em.regexFlag.FindStringSubmatch(flag)
+		value := flag
+		if len(flagMatch) > 0 {
+			flagData.Name = unescape(flagMatch[1])
+			value = flagMatch[2]
+		}
+		if em.configuration.NestedFlags && len(value) >= 2 && value[0] == '{' && value[len(value)-1] == '}' {
+			flagData.Flag = em.parseFlags(value[1 : len(value)-1])
+			if len(flagData.Flag) > 0 {
+				parsed = append(parsed, flagData)
+			}
+			continue
+		}
+		if em.configuration.FlagUnquote {
+			value = unquote(value)
+		}
+		flagData.Value = unescape(value)
+		// Empty flags (e.g. a stray FlagSplit) carry no data
+		if len(flagData.Name) == 0 && len(flagData.Value) == 0 {
+			continue
+		}
+		parsed = append(parsed, flagData)
+	}
+	return parsed
+}
+
+// duplicateFlags applies the provided FlagDuplicatePolicy to named flags
+func duplicateFlags(flags []*EmitFlag, policy string) ([]*EmitFlag, error) {
+	switch policy {
+	case "", FlagDuplicateKeep:
+		return flags, nil
+	case FlagDuplicateLast:
+		seen := make(map[string]bool)
+		kept := make([]*EmitFlag, 0, len(flags))
+		for i := len(flags) - 1; i >= 0; i-- {
+			name := flags[i].Name
+			if len(name) > 0 && seen[name] {
+				continue
+			}
+			seen[name] = true
+			kept = append(kept, flags[i])
+		}
+		for a, b := 0, len(kept)-1; a < b; a, b = a+1, b-1 {
+			kept[a], kept[b] = kept[b], kept[a]
+		}
+		return kept, nil
+	case FlagDuplicateError:
+		seen := make(map[string]bool)
+		for _, f := range flags {
+			if len(f.Name) > 0 && seen[f.Name] {
+				return nil, fmt.Errorf("duplicate flag %v", f.Name)
+			}
+			seen[f.Name] = true
+		}
+		return flags, nil
+	}
+	return nil, fmt.Errorf("unknown flag duplicate policy %v", policy)
+}
+
+// isExposedCode returns true if the FileNode line is exposed but not a comment
+func (f *FileNode) isExposedCode() bool {
+	return f.Line.IsExposed() && !f.Line.IsComment()
+}
+
+// processExposed returns EmitNode with the exposed code of its Child and the provided siblings as a single Data, valued by the code and ranged by its lines
+func (f *FileNode) processExposed(em *emitter, inherited map[string]string, siblings []*FileNode) (*EmitNode, error) {
+	marker := *f
+	marker.Child = nil
+	var code []*FileNode
+	for _, c := range f.Child {
+		if c.isExposedCode() {
+			code = append(code, c)
+		} else {
+			marker.Child = append(marker.Child, c)
+		}
+	}
+	e, err := marker.process(em, inherited)
+	if err != nil {
+		return nil, err
+	}
+	var lines []*LineNode
+	for _, c := range append(code, siblings...) {
+		lines = append(lines, c.lines()...)
+	}
+	if len(lines) == 0 {
+		return e, nil
+	}
+	indent := lines[0].Indent
+	for _, l := range lines {
+		if l.Indent < indent && len(l.Value) > 0 {
+			indent = l.Indent
+		}
+	}
+	values := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if len(l.Value) > 0 && l.Indent > indent {
+			values = append(values, strings.Repeat(" ", l.Indent-indent)+l.Value)
+		} else {
+			values = append(values, l.Value)
+		}
+	}
+	block := &EmitNode{
+		Value:     strings.Join(values, "\n"),
+		Line:      lines[0].Number,
+		LineStart: lines[0].Number,
+		LineEnd:   lines[len(lines)-1].Number,
+	}
+	e.Data = append(e.Data, block)
+	if block.LineEnd > e.LineEnd {
+		e.LineEnd = block.LineEnd
+	}
+	return e, nil
+}
+
+// Walk calls fn with EmitNode and each descendant Data in pre-order, stopping at and returning the first error
+func (e *EmitNode) Walk(fn func(*EmitNode) error) error {
+	if err := fn(e); err != nil {
+		return err
+	}
+	for _, d := range e.Data {
+		if err := d.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlagValue returns the value of the first EmitFlag with the provided name, and whether one was found
+func (e *EmitNode) FlagValue(name string) (string, bool) {
+	for _, flag := range e.Flag {
+		if flag.Name == name {
+			return flag.Value, true
+		}
+	}
+	return "", false
+}
+
+// HasFlag returns true if EmitNode has an EmitFlag with the provided name
+func (e *EmitNode) HasFlag(name string) bool {
+	_, ok := e.FlagValue(name)
+	return ok
+}
+
+// KeywordCounts returns the number of times each keyword appears within the EmitNode tree; EmitNode without a keyword are ignored
+func (e *EmitNode) KeywordCounts() map[string]int {
+	counts := make(map[string]int)
+	e.Walk(func(n *EmitNode) error {
+		if len(n.Keyword) > 0 {
+			counts[n.Keyword]++
+		}
+		return nil
+	})
+	return counts
+}
+
+// Find returns every descendant Data whose keyword exactly matches the provided keyword in document order
+func (e *EmitNode) Find(keyword string) []*EmitNode {
+	return e.find(func(k string) bool {
+		return k == keyword
+	}, false)
+}
+
+// FindFold is Find with case-insensitive keyword matching
+func (e *EmitNode) FindFold(keyword string) []*EmitNode {
+	return e.find(func(k string) bool {
+		return strings.EqualFold(k, keyword)
+	}, false)
+}
+
+// FindFirst returns the first descendant Data whose keyword exactly matches the provided keyword, or nil if not found
+func (e *EmitNode) FindFirst(keyword string) *EmitNode {
+	found := e.find(func(k string) bool {
+		return k == keyword
+	}, true)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// FindFirstFold is FindFirst with case-insensitive keyword matching
+func (e *EmitNode) FindFirstFold(keyword string) *EmitNode {
+	found := e.find(func(k string) bool {
+		return strings.EqualFold(k, keyword)
+	}, true)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// find returns the descendant Data whose keyword satisfies match in document order, stopping at the first if first is set
+func (e *EmitNode) find(match func(string) bool, first bool) []*EmitNode {
+	var found []*EmitNode
+	for _, d := range e.Data {
+		if len(d.Keyword) > 0 && match(d.Keyword) {
+			found = append(found, d)
+			if first {
+				return found
+			}
+		}
+		found = append(found, d.find(match, first)...)
+		if first && len(found) > 0 {
+			return found
+		}
+	}
+	return found
+}
+
+// Select returns every descendant EmitNode, in document order, whose flags satisfy pred
+func (e *EmitNode) Select(pred func([]*EmitFlag) bool) []*EmitNode {
+	var selected []*EmitNode
+	for _, d := range e.Data {
+		if pred(d.Flag) {
+			selected = append(selected, d)
+		}
+		selected = append(selected, d.Select(pred)...)
+	}
+	return selected
+}
+
+// inherit appends each inherited flag named in names that EmitNode does not set, returning the flags inherited by its Data
+func (e *EmitNode) inherit(inherited map[string]string, names []string) map[string]string {
+	own := make(map[string]string)
+	for _, flag := range e.Flag {
+		if _, ok := own[flag.Name]; !ok {
+			own[flag.Name] = flag.Value
+		}
+	}
+	next := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, ok := own[name]; ok {
+			next[name] = value
+		} else if value, ok := inherited[name]; ok {
+			e.Flag = append(e.Flag, &EmitFlag{
+				Name:  name,
+				Value: value,
+			})
+			next[name] = value
+		}
+	}
+	return next
+}
+
+// splitFlags splits flags by delimiter, ignoring any delimiter within double quotes, escaped by a backslash or, if nested, within braces
+func splitFlags(flags string, delimiter string, nested bool) []string {
+	var tokens []string
+	quoted := false
+	depth := 0
+	start := 0
+	for i := 0; i < len(flags); {
+		if flags[i] == '\\' {
+			i += 2
+			continue
+		} else if flags[i] == '"' {
+			quoted = !quoted
+		} else if nested && !quoted && flags[i] == '{' {
+			depth++
+		} else if nested && !quoted && flags[i] == '}' && depth > 0 {
+			depth--
+		} else if !quoted && depth == 0 && strings.HasPrefix(flags[i:], delimiter) {
+			tokens = append(tokens, flags[start:i])
+			i += len(delimiter)
+			start = i
+			continue
+		}
+		i++
+	}
+	return append(tokens, flags[start:])
+}
+
+// splitValues splits value by whitespace, keeping double quoted tokens whole and removing their quotes
+func splitValues(value string) []string {
+	var values []string
+	var b strings.Builder
+	quoted, token := false, false
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token = true
+		case unicode.IsSpace(r) && !quoted:
+			if token {
+				values = append(values, b.String())
+				b.Reset()
+				token = false
+			}
+		default:
+			b.WriteRune(r)
+			token = true
+		}
+	}
+	if token {
+		values = append(values, b.String())
+	}
+	return values
+}
+
+// unquote removes the unescaped double quotes surrounding value
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' && value[len(value)-2] != '\\' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// unescape removes the backslash preceding each escaped character
+func unescape(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// FilterSeverity removes keyword Data whose SeverityFlag ranks below min in order; EmitNode without a known severity are kept
+func (e *EmitNode) FilterSeverity(min string, order []string) error {
+	rank := make(map[string]int, len(order))
+	for i, o := range order {
+		rank[o] = i
+	}
+	threshold, ok := rank[min]
+	if !ok {
+		return fmt.Errorf("could not filter severity: unknown severity %v", min)
+	}
+	e.filterSeverity(threshold, rank)
+	return nil
+}
+
+// filterSeverity removes keyword Data whose SeverityFlag rank is below threshold
+func (e *EmitNode) filterSeverity(threshold int, rank map[string]int) {
+	data := make([]*EmitNode, 0, len(e.Data))
+	for _, d := range e.Data {
+		if len(d.Keyword) > 0 {
+			below := false
+			for _, flag := range d.Flag {
+				if flag.Name == SeverityFlag {
+					r, ok := rank[flag.Value]
+					below = ok && r < threshold
+					break
+				}
+			}
+			if below {
+				continue
+			}
+		}
+		d.filterSeverity(threshold, rank)
+		data = append(data, d)
+	}
+	e.Data = data
+}
+
+// Coalesce joins the value of each keywordless, childless Data into the EmitNode value using join
+func (e *EmitNode) Coalesce(join string) {
+	values := []string{e.Value}
+	data := make([]*EmitNode, 0, len(e.Data))
+	for _, d := range e.Data {
+		if len(d.Keyword) == 0 && len(d.Data) == 0 {
+			values = append(values, d.Value)
+		} else {
+			data = append(data, d)
+		}
+	}
+	if len(values) > 1 {
+		e.Value = strings.Join(values, join)
+		e.Data = data
+	}
+}
+
+// isEmpty returns true if EmitNode has no keyword, flags, value, tags or Data
+func (e *EmitNode) isEmpty() bool {
+	return len(e.Keyword) == 0 && len(e.Flag) == 0 && len(e.Value) == 0 && len(e.Tag) == 0 && len(e.Data) == 0
+}
+
+// Dedupe collapses each run of consecutive empty Data, throughout the EmitNode tree, into the first of the run
+func (e *EmitNode) Dedupe() {
+	data := make([]*EmitNode, 0, len(e.Data))
+	for _, d := range e.Data {
+		d.Dedupe()
+		if d.isEmpty() && len(data) > 0 && data[len(data)-1].isEmpty() {
+			last := data[len(data)-1]
+			if d.LineEnd > last.LineEnd {
+				last.LineEnd = d.LineEnd
+			}
+			continue
+		}
+		data = append(data, d)
+	}
+	e.Data = data
+}
+
+// Hash returns the SHA-256 of the EmitNode keyword, flags, including nested flags, and value
+func (e *EmitNode) Hash() string {
+	h := sha256.New()
+	h.Write([]byte(e.Keyword))
+	hashFlags(h, e.Flag)
+	h.Write([]byte{0})
+	h.Write([]byte(e.Value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFlags writes the name and value of each EmitFlag to h, enclosing any nested flags so their depth is distinguished
+func hashFlags(h io.Writer, flags []*EmitFlag) {
+	for _, flag := range flags {
+		h.Write([]byte{0})
+		h.Write([]byte(flag.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(flag.Value))
+		if len(flag.Flag) > 0 {
+			h.Write([]byte{1})
+			hashFlags(h, flag.Flag)
+			h.Write([]byte{2})
+		}
+	}
+}
+
+// File returns EmitFile from EmitNode; an empty inputPath defaults to the name provided at Build and meta is appended to any hoisted MetaData
+func (e *EmitNode) File(inputPath string, meta []*MetaData) *EmitFile {
 	emits := &EmitFile{
-		Meta: &EmitMeta{
-			File:      inputPath,
-			Data:      meta,
-			Timestamp: time.Now().String(),
-		},
+		Meta: &EmitMeta{},
 		Data: e.Data,
 	}
-	data, err := json.Marshal(emits)
+	if e.Meta != nil {
+		*emits.Meta = *e.Meta
+	}
+	if len(inputPath) > 0 {
+		emits.Meta.File = inputPath
+	}
+	if e.emptyArrays && emits.Data == nil {
+		emits.Data = []*EmitNode{}
+	}
+	emits.Meta.Data = append(append([]*MetaData(nil), emits.Meta.Data...), meta...)
+	now := e.now
+	if now == nil {
+		now = time.Now
+	}
+	emits.Meta.Timestamp = now().UTC().Format(time.RFC3339)
+	return emits
+}
+
+// EmitFile emits the FileNode and returns its EmitFile without writing it; an empty inputPath defaults to the name provided at Build
+func (f *FileNode) EmitFile(inputPath string, meta []*MetaData) (*EmitFile, error) {
+	emits, err := f.Emit()
+	if err != nil {
+		return nil, err
+	}
+	return emits.File(inputPath, meta), nil
+}
+
+// MergeEmitFiles returns a single EmitFile of the Data of every EmitFile in order; each EmitMeta is kept in EmitMeta.Source, top level Data are copied to serialize their EmitMeta.File as file, and the latest Timestamp is kept
+func MergeEmitFiles(files []*EmitFile) *EmitFile {
+	merged := &EmitFile{
+		Meta: &EmitMeta{},
+		Data: make([]*EmitNode, 0),
+	}
+	for _, file := range files {
+		if file == nil {
+			continue
+		}
+		source := ""
+		if file.Meta != nil {
+			merged.Meta.Source = append(merged.Meta.Source, file.Meta)
+			if file.Meta.Timestamp > merged.Meta.Timestamp {
+				merged.Meta.Timestamp = file.Meta.Timestamp
+			}
+			source = file.Meta.File
+		}
+		for _, d := range file.Data {
+			data := *d
+			if len(data.sourceFile) == 0 {
+				data.sourceFile = source
+			}
+			merged.Data = append(merged.Data, &data)
+		}
+	}
+	return merged
+}
+
+// Write generates and saves the EmitNode to disk; an empty inputPath defaults to the name provided at Build, and an outputPath with GzipExtension is gzip compressed
+func (e *EmitNode) Write(inputPath string, outputPath string, meta []*MetaData) error {
+	return writeFile(outputPath, e.File(inputPath, meta))
+}
+
+// WriteIndented generates and saves the EmitNode to disk with each JSON element on a new line prefixed by indent per nesting level
+func (e *EmitNode) WriteIndented(inputPath string, outputPath string, meta []*MetaData, indent string) error {
+	file := e.File(inputPath, meta)
+	return writeFile(outputPath, writerToFunc(func(w io.Writer) (int64, error) {
+		return file.WriteIndentTo(w, indent)
+	}))
+}
+
+// EmitRecord contains a single top level EmitNode and the EmitMeta of its file
+type EmitRecord struct {
+	Meta *EmitMeta `json:"meta,omitempty"`
+	Data *EmitNode `json:"data"`
+}
+
+// AppendNDJSON appends an EmitRecord line for each Data to the file at path, creating it if needed; a nil meta defaults to the EmitMeta provided at Emit
+func (e *EmitNode) AppendNDJSON(path string, meta *EmitMeta) error {
+	if meta == nil {
+		meta = e.Meta
+	}
+	return openFile(path, os.O_APPEND, writerToFunc(func(w io.Writer) (int64, error) {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		for _, d := range e.Data {
+			err := encoder.Encode(&EmitRecord{
+				Meta: meta,
+				Data: d,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+		// A single write keeps each batch contiguous
+		n, err := w.Write(buf.Bytes())
+		return int64(n), err
+	}))
+}
+
+// WriteTo encodes the EmitFile to the provided io.Writer, returning the number of bytes written
+func (e *EmitFile) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// WriteIndentTo encodes the EmitFile, indented by indent per nesting level, to the provided io.Writer
+func (e *EmitFile) WriteIndentTo(w io.Writer, indent string) (int64, error) {
+	data, err := json.MarshalIndent(e, "", indent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// WriteCanonical writes the EmitFile with sorted keys, indentation, and no timestamp so identical content is byte-identical
+func (e *EmitFile) WriteCanonical(w io.Writer) error {
+	canonical := *e
+	if e.Meta != nil {
+		meta := *e.Meta
+		meta.Timestamp = ""
+		canonical.Meta = &meta
+	}
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return err
+	}
+	// Decoding into generic values sorts object keys when encoded again
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err = d.Decode(&value)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Rows returns an EmitRow for each EmitFlag of each EmitNode in document order, or a single EmitRow for EmitNode without EmitFlag; nested EmitFlag names are joined by a dot
+func (e *EmitFile) Rows() []EmitRow {
+	var file string
+	if e.Meta != nil {
+		file = e.Meta.File
+	}
+	var rows []EmitRow
+	var flatten func(prefix string, flags []*EmitFlag, row EmitRow)
+	flatten = func(prefix string, flags []*EmitFlag, row EmitRow) {
+		for _, f := range flags {
+			name := prefix + f.Name
+			if len(f.Flag) > 0 {
+				flatten(name+".", f.Flag, row)
+				continue
+			}
+			value := f.Value
+			row.FlagName = &name
+			row.FlagValue = &value
+			rows = append(rows, row)
+		}
+	}
+	var walk func(data []*EmitNode, depth int)
+	walk = func(data []*EmitNode, depth int) {
+		for _, d := range data {
+			row := EmitRow{
+				File:    file,
+				Line:    d.Line,
+				Depth:   depth,
+				Keyword: d.Keyword,
+				Value:   d.Value,
+			}
+			if len(d.Flag) == 0 {
+				rows = append(rows, row)
+			} else {
+				flatten("", d.Flag, row)
+			}
+			walk(d.Data, depth+1)
+		}
+	}
+	walk(e.Data, 0)
+	return rows
+}
+
+// Summary returns FileSummary counting each keyword EmitNode; Hash is the SHA-256 of the canonical EmitFile
+func (e *EmitFile) Summary() *FileSummary {
+	summary := &FileSummary{
+		Keyword: (&EmitNode{Data: e.Data}).KeywordCounts(),
+	}
+	if e.Meta != nil {
+		summary.File = e.Meta.File
+	}
+	for _, count := range summary.Keyword {
+		summary.Directive += count
+	}
+	h := sha256.New()
+	// EmitFile always marshals, and a hash.Hash never returns an error
+	_ = e.WriteCanonical(h)
+	summary.Hash = hex.EncodeToString(h.Sum(nil))
+	return summary
+}
+
+// WriteSummary generates and saves the FileSummary to disk
+func (e *EmitFile) WriteSummary(path string) error {
+	data, err := json.Marshal(e.Summary())
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(outputPath, data, 0644)
+	err = os.WriteFile(path, data, 0644)
 	if err != nil {
 		return err
 	}
@@ -1,8 +1,24 @@
 package core_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emits-io/core"
 )
@@ -24,10 +40,10 @@ func Test_Build(t *testing.T) {
 		},
 		Plugin: &[]core.Plugin{
 			{
-				"./foo.js",
+				"./testdata/plugin/foo.js",
 			},
 			{
-				"./bar.js",
+				"./testdata/plugin/bar.js",
 			},
 		},
 		RegularExpression: &r,
@@ -53,21 +69,96 @@ func Test_Build(t *testing.T) {
 	}
 }
 
-func Test_Build_Error(t *testing.T) {
+func Test_BuildReader(t *testing.T) {
 	f := &core.FileNode{}
-	_, err := f.Build("", &core.Configuration{})
-	if err == nil {
-		t.Errorf("Build() expects error, got %v", err)
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\nfunc main() {}\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if emits.Meta.File != "main.go" {
+		t.Errorf("Emit() meta file expects main.go, got %v", emits.Meta.File)
+	}
+	if len(emits.Data) != 1 || emits.Data[0].Keyword != "keyword" || emits.Data[0].Value != "value" {
+		t.Errorf("Emit() expects a single keyword node, got %v", emits.Data)
 	}
 }
 
-func Test_Build_RegularExpression_Error(t *testing.T) {
-	r := make([]core.RegularExpression, 0)
-	r = append(r, core.RegularExpression{
-		Find: "a(",
+func Test_Build_Gzip(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.Build("testdata/fixture.go.gz", &core.Configuration{})
+	if err != nil {
+		t.Fatalf("Build() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if emits.Meta.File != "testdata/fixture.go" || emits.Meta.Language != "go" {
+		t.Errorf("Emit() meta expects testdata/fixture.go in go, got %v in %v", emits.Meta.File, emits.Meta.Language)
+	}
+	if len(emits.Data) != 1 || emits.Data[0].Keyword != "function" || len(emits.Data[0].Data) != 1 || emits.Data[0].Data[0].Value != "x" {
+		t.Errorf("Emit() expects the decompressed function and param, got %v", emits.Data)
+	}
+}
+
+func Test_Build_Decompress(t *testing.T) {
+	data, err := os.ReadFile("testdata/fixture.go.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "fixture.go")
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &core.FileNode{}
+	_, err = f.Build(path, &core.Configuration{})
+	if err != nil || len(f.Child) > 0 {
+		t.Errorf("Build() expects no comments in compressed bytes, got %v, %v", f.Child, err)
+	}
+	f = &core.FileNode{}
+	_, err = f.Build(path, &core.Configuration{
+		Decompress: true,
 	})
+	if err != nil || len(f.Child) != 1 || f.Name != path {
+		t.Errorf("Build() expects the decompressed function of %v, got %v, %v", path, f.Child, err)
+	}
+	_, err = f.Build("core.go", &core.Configuration{
+		Decompress: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "could not decompress file") {
+		t.Errorf("Build() expects a decompress error, got %v", err)
+	}
+}
+
+func Test_Build_Stdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+	}()
+	go func() {
+		_, _ = w.WriteString("// .keyword`flag:value` stdin\n  // .child nested\nfunc main() {}\n")
+		_ = w.Close()
+	}()
 	f := &core.FileNode{}
-	_, err := f.Build("core.go", &core.Configuration{
+	_, err = f.Build(core.Stdin, &core.Configuration{
 		Comment: &core.Comment{
 			Line: "//",
 			Block: &core.CommentBlock{
@@ -75,15 +166,30 @@ func Test_Build_RegularExpression_Error(t *testing.T) {
 				End:   "*/",
 			},
 		},
-		RegularExpression: &r,
 	})
-	if err == nil {
-		t.Errorf("Build() expects error, got %v", err)
+	if err != nil {
+		t.Errorf("Build() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if emits.Meta.File != core.StdinName {
+		t.Errorf("Emit() meta file expects %v, got %v", core.StdinName, emits.Meta.File)
+	}
+	if len(emits.Data) != 1 || emits.Data[0].Value != "stdin" || len(emits.Data[0].Flag) != 1 {
+		t.Fatalf("Emit() expects a single flagged keyword node, got %v", emits.Data)
+	}
+	if len(emits.Data[0].Data) != 1 || emits.Data[0].Data[0].Keyword != "child" {
+		t.Errorf("Emit() expects a nested child keyword node, got %v", emits.Data[0].Data)
 	}
 }
 
-func Test_Line_IsComment(t *testing.T) {
-	l := core.Line(&core.FileNode{}, "//", &core.Configuration{
+func Test_BuildReaderContext_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f := &core.FileNode{}
+	_, err := f.BuildReaderContext(ctx, strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
 		Comment: &core.Comment{
 			Line: "//",
 			Block: &core.CommentBlock{
@@ -91,14 +197,20 @@ func Test_Line_IsComment(t *testing.T) {
 				End:   "*/",
 			},
 		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
 	})
-	b := l.IsComment()
-	if !b {
-		t.Errorf("IsComment() expects true, got %v", b)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("BuildReaderContext() expects context.Canceled, got %v", err)
 	}
 }
-func Test_Line_IsCommentBlockStart(t *testing.T) {
-	l := core.Line(&core.FileNode{}, "/*", &core.Configuration{
+
+func Test_Build_Language(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.Build("core.go", &core.Configuration{
 		Comment: &core.Comment{
 			Line: "//",
 			Block: &core.CommentBlock{
@@ -107,14 +219,21 @@ func Test_Line_IsCommentBlockStart(t *testing.T) {
 			},
 		},
 	})
-	b := l.IsCommentBlockStart()
-	if !b {
-		t.Errorf("IsCommentBlockStart() expecting true, got %v", b)
+	if err != nil {
+		t.Errorf("Build() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if emits.Meta.Language != "go" {
+		t.Errorf("Emit() meta language expects go, got %v", emits.Meta.Language)
 	}
 }
 
-func Test_Line_IsCommentBlockEnd(t *testing.T) {
-	l := core.Line(&core.FileNode{}, "*/", &core.Configuration{
+func Test_Emit_LineTagPattern(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// [security] [perf] validate input\n"), "main.go", &core.Configuration{
 		Comment: &core.Comment{
 			Line: "//",
 			Block: &core.CommentBlock{
@@ -122,16 +241,22 @@ func Test_Line_IsCommentBlockEnd(t *testing.T) {
 				End:   "*/",
 			},
 		},
+		LineTagPattern: "\\[(\\w+)\\]",
 	})
-	b := l.IsCommentBlockEnd()
-	if !b {
-		t.Errorf("IsCommentBlockEnd() expects true, got %v", b)
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if len(emits.Data) != 1 || strings.Join(emits.Data[0].Tag, ",") != "security,perf" {
+		t.Errorf("Emit() expects tags security,perf, got %v", emits.Data)
 	}
 }
 
-func Test_Line_IsExposed(t *testing.T) {
-	l := core.Line(&core.FileNode{}, "// >", &core.Configuration{
-		Expose: true,
+func Test_BuildReader_LongLine(t *testing.T) {
+	configuration := &core.Configuration{
 		Comment: &core.Comment{
 			Line: "//",
 			Block: &core.CommentBlock{
@@ -139,147 +264,3525 @@ func Test_Line_IsExposed(t *testing.T) {
 				End:   "*/",
 			},
 		},
-	})
-	b := l.IsExposed()
-	if !b {
-		t.Errorf("IsExposed() expects true, got %v", b)
 	}
-}
-
-func Test_Line_IsExposed_False(t *testing.T) {
-	l := core.LineNode{}
-	b := l.IsExposed()
-	if b {
-		t.Errorf("IsExposed() expects false, got %v", b)
+	data := "// .keyword " + strings.Repeat("a", 128*1024) + "\n"
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader(data), "main.go", configuration)
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	if len(f.Child) != 1 || len(f.Child[0].Line.Value) != len(data)-4 {
+		t.Errorf("BuildReader() expects a single long line, got %v", len(f.Child))
+	}
+	configuration.MaxLineSize = 64 * 1024
+	f = &core.FileNode{}
+	_, err = f.BuildReader(strings.NewReader(data), "main.go", configuration)
+	if err == nil || !strings.Contains(err.Error(), "line 1 exceeds") {
+		t.Errorf("BuildReader() expects line size error, got %v", err)
 	}
 }
 
-func Test_Line_Insert(t *testing.T) {
+func Test_BuildReader_CRLF(t *testing.T) {
 	f := &core.FileNode{}
-	f.Insert(1, &core.LineNode{
-		Indent: 4,
-	})
-	f.Insert(2, &core.LineNode{
-		Indent: 2,
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\r\n// .example >\r\nfunc main() {}\r\n"), "main.go", &core.Configuration{
+		Expose: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
 	})
-	if f.Child[0].Line.Indent != 4 {
-		t.Errorf("Insert() line indent expects 4, got %v", f.Child[0].Line.Indent)
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-	if f.Child[0].Child[0].Line.Indent != 2 {
-		t.Errorf("Insert() line indent expects 2, got %v", f.Child[0].Child[0].Line.Indent)
+	if len(f.Child) != 3 {
+		t.Fatalf("BuildReader() expects 3 lines, got %v", len(f.Child))
+	}
+	if f.Child[0].Line.Value != ".keyword value" {
+		t.Errorf("BuildReader() expects trimmed value, got %q", f.Child[0].Line.Value)
+	}
+	if !f.Child[1].Line.IsExposed() || f.Child[1].Line.Value != ".example" {
+		t.Errorf("BuildReader() expects exposed marker, got %q", f.Child[1].Line.Value)
+	}
+	if !f.Child[2].Line.IsExposed() || f.Child[2].Line.Value != "func main() {}" {
+		t.Errorf("BuildReader() expects exposed code, got %q", f.Child[2].Line.Value)
 	}
 }
 
-func Test_File_LastIndent(t *testing.T) {
-	c := make([]*core.FileNode, 0)
-	c = append(c, &core.FileNode{
-		Line: &core.LineNode{
-			Indent: 3,
+func Test_BuildReader_UnterminatedBlock(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("/* closed */\nfunc main() {}\n/*\n  .keyword value\nfunc foo() {}\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
 		},
 	})
-	f := &core.FileNode{
-		Line: &core.LineNode{
-			Indent: 5,
-		},
-		Child: c,
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-	n := f.LastNode().LastIndent(3)
-	if n == nil || n.Line.Indent != 3 {
-		t.Errorf("LastIndent(3) expects 3, got %v", n.Line.Indent)
+	if len(f.Diagnostic) != 1 || f.Diagnostic[0].Line != 3 || f.Diagnostic[0].Severity != core.DiagnosticError {
+		t.Errorf("BuildReader() expects an unterminated block diagnostic on line 3, got %v", f.Diagnostic)
 	}
 }
 
-func Test_File_LastIndent_Nil(t *testing.T) {
-	c := make([]*core.FileNode, 0)
-	c = append(c, &core.FileNode{
-		Line: &core.LineNode{
-			Indent: 3,
+func Test_BuildReader_MultilineBlock(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("/* .a\n  .b\n  .c\n  .d\n*/\nfunc main() {}\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
 		},
 	})
-	f := &core.FileNode{
-		Line: &core.LineNode{
-			Indent: 5,
-		},
-		Child: c,
-	}
-	n := f.LastNode().LastIndent(1)
-	if n != nil {
-		t.Errorf("LastIndent(1) expects nil, got %v", n.Line.Indent)
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-}
-
-func Test_CompileRegularExpressions(t *testing.T) {
-	r := make([]core.RegularExpression, 0)
-	r = append(r, core.RegularExpression{
-		Find: "a(-b]+c)",
+	var lines []*core.LineNode
+	f.Walk(func(n *core.FileNode) error {
+		if n.Line != nil {
+			lines = append(lines, n.Line)
+		}
+		return nil
 	})
-	configuration := core.Configuration{
-		RegularExpression: &r,
+	if len(lines) != 5 {
+		t.Fatalf("BuildReader() expects 5 comment lines, got %v", len(lines))
 	}
-	err := configuration.CompileRegularExpressions()
-	if err != nil {
-		t.Errorf("CompileRegularExpressions() expects nil, got %v", err)
+	for _, l := range lines[1:4] {
+		if !l.CommentBlockLine || l.Value != fmt.Sprintf(".%c", 'a'+l.Number-1) {
+			t.Errorf("BuildReader() expects line %v within the block, got %+v", l.Number, l)
+		}
+	}
+	if !lines[4].CommentBlockEnd || len(f.Diagnostic) > 0 {
+		t.Errorf("BuildReader() expects the block to end on line 5, got %+v, %v", lines[4], f.Diagnostic)
 	}
 }
 
-func Test_CompileRegularExpressions_Error(t *testing.T) {
-	r := make([]core.RegularExpression, 0)
-	r = append(r, core.RegularExpression{
-		Find: "a(-b]+c",
+func Test_BuildReader_SymmetricBlock(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("\"\"\" .a\n.b\n.c\n\"\"\"\ndef main():\n    pass\n"), "main.py", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "#",
+			Block: &core.CommentBlock{
+				Start:     `"""`,
+				End:       `"""`,
+				Symmetric: true,
+			},
+		},
 	})
-	configuration := core.Configuration{
-		RegularExpression: &r,
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-	err := configuration.CompileRegularExpressions()
-	if err == nil {
-		t.Errorf("CompileRegularExpressions() expects error, got %v", err)
+	if len(f.Child) != 4 || !f.Child[2].Line.CommentBlockLine || !f.Child[3].Line.CommentBlockEnd || f.Child[3].Line.CommentBlockStart {
+		t.Errorf("BuildReader() expects a block ending on line 4, got %v", f.Child)
 	}
 }
 
-func Test_Process_RegularExpression_Flag_Array(t *testing.T) {
-	regexEmits, err := regexp.Compile(core.EmitsRegex)
+func Test_Emit_ContinuationPrefix(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("/**\n * .function foo\n * .param bar\n *\n */\nfunction foo(bar) {}\n"), "main.js", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start:              "/*",
+				End:                "*/",
+				ContinuationPrefix: "*",
+			},
+		},
+	})
 	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-	regexFlag, err := regexp.Compile(core.EmitsFlagRegex)
+	emits, err := f.Emit()
 	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+		t.Errorf("Emit() expects nil, got %s", err)
 	}
-	n := core.FileNode{
-		Line: &core.LineNode{
-			Value: ".keyword`flag:flag_value,foo:world` value",
-		},
+	var keywords []string
+	emits.Walk(func(e *core.EmitNode) error {
+		if len(e.Keyword) > 0 {
+			keywords = append(keywords, e.Keyword+" "+e.Value)
+		}
+		return nil
+	})
+	if strings.Join(keywords, ",") != "function foo,param bar" {
+		t.Errorf("Emit() expects function foo,param bar, got %v", keywords)
 	}
-	_, err = n.Process(regexEmits, regexFlag)
-	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+	if c := f.Child[0].Child[0].Line.ValueColumn; c != 3 {
+		t.Errorf("BuildReader() expects value column 3, got %v", c)
 	}
 }
 
-func Test_Process_RegularExpression_Flag_String(t *testing.T) {
-	regexEmits, err := regexp.Compile(core.EmitsRegex)
+func Test_Emit_LineContinuation(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .description first \\\n//    second\n// .description one\\\n//   two   \\\n//  three\n// .keyword value \\\nfunc main() {}\n/* .block a \\\n   b */\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		LineContinuation: "\\",
+	})
 	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+		t.Errorf("BuildReader() expects nil, got %s", err)
 	}
-	regexFlag, err := regexp.Compile(core.EmitsFlagRegex)
+	emits, err := f.Emit()
 	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+		t.Errorf("Emit() expects nil, got %s", err)
 	}
-	n := core.FileNode{
-		Line: &core.LineNode{
-			Value: ".keyword`hello world` value",
-		},
+	if len(emits.Data) != 4 {
+		t.Fatalf("Emit() expects 4 Data, got %v", len(emits.Data))
 	}
-	_, err = n.Process(regexEmits, regexFlag)
-	if err != nil {
-		t.Errorf("Process() expects nil, got %v", err)
+	if emits.Data[0].Value != "first second" || emits.Data[0].Line != 1 {
+		t.Errorf("Emit() expects a two line continuation, got %q", emits.Data[0].Value)
+	}
+	if emits.Data[1].Value != "one two three" || emits.Data[1].Line != 3 {
+		t.Errorf("Emit() expects a three line continuation, got %q", emits.Data[1].Value)
+	}
+	if emits.Data[2].Value != "value \\" {
+		t.Errorf("Emit() expects an uncontinued value, got %q", emits.Data[2].Value)
+	}
+	if emits.Data[3].Value != "a b" || emits.Data[3].Line != 8 || len(f.Diagnostic) > 0 {
+		t.Errorf("Emit() expects a continued comment block, got %q, %v", emits.Data[3].Value, f.Diagnostic)
 	}
 }
 
-func Test_File_Write_Error(t *testing.T){
+func Test_Emit_NestByKeywordDepth(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .list fruits\n      // ..item apple\n  // ...note red\n    // plain\n// ..item banana\nfunc main() {}\n        // .list vegetables\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		NestBy: core.NestByKeywordDepth,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if len(emits.Data) != 2 || emits.Data[0].Value != "fruits" || emits.Data[1].Value != "vegetables" {
+		t.Fatalf("Emit() expects two lists, got %v", emits.Data)
+	}
+	items := emits.Data[0].Data
+	if len(items) != 2 || items[0].Keyword != "item" || items[0].Value != "apple" || items[1].Value != "banana" {
+		t.Fatalf("Emit() expects apple and banana items, got %v", items)
+	}
+	if len(items[0].Data) != 1 || items[0].Data[0].Keyword != "note" || len(items[0].Data[0].Data) != 1 || items[0].Data[0].Data[0].Value != "plain" {
+		t.Errorf("Emit() expects a note containing plain, got %v", items[0].Data)
+	}
+	if c := f.Child[0].Child[0].Line.ValueColumn; c != 10 {
+		t.Errorf("BuildReader() expects value column 10, got %v", c)
+	}
+}
+
+func Test_BuildReader_NestBy_Unknown(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		NestBy: "outline",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown nest by outline") {
+		t.Errorf("BuildReader() expects unknown nest by, got %v", err)
+	}
+}
+
+func Test_BuildReader_BOM(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("\uFEFF// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	if len(f.Child) != 1 || !f.Child[0].Line.CommentLine || f.Child[0].Line.Value != ".keyword value" {
+		t.Errorf("BuildReader() expects a comment line without BOM, got %v", f.Child)
+	}
+}
+
+func Test_BuildReader_TabWidth(t *testing.T) {
+	var trees []string
+	for _, data := range []string{
+		"// .parent value\n    // .child value\n        // .grandchild value\n    // .sibling value\n",
+		"// .parent value\n\t// .child value\n\t\t// .grandchild value\n\t// .sibling value\n",
+		"// .parent value\n  \t// .child value\n\t    // .grandchild value\n\t// .sibling value\n",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader(data), "main.go", &core.Configuration{
+			TabWidth: 4,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		// Offsets differ by design; only the structure is compared
+		var reset func(n *core.FileNode)
+		reset = func(n *core.FileNode) {
+			if n.Line != nil {
+				n.Line.StartOffset, n.Line.ValueColumn = 0, 0
+			}
+			for _, c := range n.Child {
+				reset(c)
+			}
+		}
+		reset(f)
+		tree, err := json.Marshal(f)
+		if err != nil {
+			t.Errorf("Marshal() expects nil, got %s", err)
+		}
+		trees = append(trees, string(tree))
+	}
+	if trees[0] != trees[1] || trees[0] != trees[2] {
+		t.Errorf("BuildReader() expects identical trees, got %v and %v and %v", trees[0], trees[1], trees[2])
+	}
+}
+
+func Test_Build_Error(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.Build("", &core.Configuration{})
+	if err == nil {
+		t.Errorf("Build() expects error, got %v", err)
+	}
+}
+
+func Test_Build_RegularExpression_Error(t *testing.T) {
+	r := make([]core.RegularExpression, 0)
+	r = append(r, core.RegularExpression{
+		Find: "a(",
+	})
+	f := &core.FileNode{}
+	_, err := f.Build("core.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &r,
+	})
+	if err == nil {
+		t.Errorf("Build() expects error, got %v", err)
+	}
+}
+
+func Test_Line_IsComment(t *testing.T) {
+	l := core.Line(&core.FileNode{}, "//", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	b := l.IsComment()
+	if !b {
+		t.Errorf("IsComment() expects true, got %v", b)
+	}
+}
+func Test_Line_IsCommentBlockStart(t *testing.T) {
+	l := core.Line(&core.FileNode{}, "/*", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	b := l.IsCommentBlockStart()
+	if !b {
+		t.Errorf("IsCommentBlockStart() expecting true, got %v", b)
+	}
+}
+
+func Test_Line_IsCommentBlockEnd(t *testing.T) {
+	l := core.Line(&core.FileNode{}, "*/", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	b := l.IsCommentBlockEnd()
+	if !b {
+		t.Errorf("IsCommentBlockEnd() expects true, got %v", b)
+	}
+}
+
+func Test_Line_IsExposed(t *testing.T) {
+	l := core.Line(&core.FileNode{}, "// >", &core.Configuration{
+		Expose: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	b := l.IsExposed()
+	if !b {
+		t.Errorf("IsExposed() expects true, got %v", b)
+	}
+}
+
+func Test_Line_IsExposed_False(t *testing.T) {
+	l := core.LineNode{}
+	b := l.IsExposed()
+	if b {
+		t.Errorf("IsExposed() expects false, got %v", b)
+	}
+}
+
+func Test_File_Reset(t *testing.T) {
+	configuration := &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	}
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .a\n// .b\n/* .c\n"), "a.go", configuration)
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %v", err)
+	}
+	f.Reset()
+	if f.Child != nil || f.Line != nil || f.Parent != nil || f.Diagnostic != nil || len(f.Name) > 0 {
+		t.Errorf("Reset() expects a zero FileNode, got %v", f)
+	}
+	_, err = f.BuildReader(strings.NewReader("// .d\n"), "d.go", configuration)
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %v", err)
+	}
+	if len(f.Child) != 1 || f.Child[0].Line.Value != ".d" {
+		t.Errorf("Reset() expects no leftover Child, got %v", f.Child)
+	}
+	if len(f.Diagnostic) != 0 || f.Name != "d.go" {
+		t.Errorf("Reset() expects no leftover Diagnostic, got %v", f.Diagnostic)
+	}
+}
+
+func Test_Line_Insert(t *testing.T) {
+	f := &core.FileNode{}
+	f.Insert(1, &core.LineNode{
+		Indent: 4,
+	})
+	f.Insert(2, &core.LineNode{
+		Indent: 2,
+	})
+	if f.Child[0].Line.Indent != 4 {
+		t.Errorf("Insert() line indent expects 4, got %v", f.Child[0].Line.Indent)
+	}
+	if f.Child[0].Child[0].Line.Indent != 2 {
+		t.Errorf("Insert() line indent expects 2, got %v", f.Child[0].Child[0].Line.Indent)
+	}
+}
+
+func Test_Line_Insert_Dedent(t *testing.T) {
+	f := &core.FileNode{}
+	for i, indent := range []int{0, 4, 8, 6, 4, 2, 8} {
+		f.Insert(i+1, &core.LineNode{
+			Indent: indent,
+		})
+	}
+	if len(f.Child) != 1 {
+		t.Errorf("Insert() root child expects 1, got %v", len(f.Child))
+	}
+	n := f.Child[0].Child[0]
+	if len(n.Child) != 1 || n.Child[0].Line.Number != 3 {
+		t.Errorf("Insert() line 3 expects child of line 2, got %v", n.Child)
+	}
+	if len(n.Child[0].Child) != 1 || n.Child[0].Child[0].Line.Number != 4 {
+		t.Errorf("Insert() line 4 expects child of line 3, got %v", n.Child[0].Child)
+	}
+	if len(f.Child[0].Child) != 2 || f.Child[0].Child[1].Line.Number != 5 {
+		t.Errorf("Insert() line 5 expects sibling of line 2, got %v", f.Child[0].Child)
+	}
+	if l := f.LastNode().Line.Number; l != 7 || f.LastNode().Parent.Line.Number != 6 {
+		t.Errorf("Insert() line 7 expects child of line 6, got %v", l)
+	}
+}
+
+func Benchmark_Insert_Deep(b *testing.B) {
+	for _, depth := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f := &core.FileNode{}
+				for l := 0; l < depth; l++ {
+					f.IsCommentWithinBlock()
+					f.Insert(l+1, &core.LineNode{
+						Indent: l,
+					})
+				}
+			}
+		})
+	}
+}
+
+func Test_File_LastIndent(t *testing.T) {
+	c := make([]*core.FileNode, 0)
+	c = append(c, &core.FileNode{
+		Line: &core.LineNode{
+			Indent: 3,
+		},
+	})
+	f := &core.FileNode{
+		Line: &core.LineNode{
+			Indent: 5,
+		},
+		Child: c,
+	}
+	n := f.LastNode().LastIndent(3)
+	if n == nil || n.Line.Indent != 3 {
+		t.Errorf("LastIndent(3) expects 3, got %v", n.Line.Indent)
+	}
+}
+
+func Test_File_LastIndent_Nil(t *testing.T) {
+	c := make([]*core.FileNode, 0)
+	c = append(c, &core.FileNode{
+		Line: &core.LineNode{
+			Indent: 3,
+		},
+	})
+	f := &core.FileNode{
+		Line: &core.LineNode{
+			Indent: 5,
+		},
+		Child: c,
+	}
+	n := f.LastNode().LastIndent(1)
+	if n != nil {
+		t.Errorf("LastIndent(1) expects nil, got %v", n.Line.Indent)
+	}
+}
+
+func Test_CompileRegularExpressions(t *testing.T) {
+	r := make([]core.RegularExpression, 0)
+	r = append(r, core.RegularExpression{
+		Find: "a(-b]+c)",
+	})
+	configuration := core.Configuration{
+		RegularExpression: &r,
+	}
+	err := configuration.CompileRegularExpressions()
+	if err != nil {
+		t.Errorf("CompileRegularExpressions() expects nil, got %v", err)
+	}
+}
+
+func Test_CompileRegularExpressions_Error(t *testing.T) {
+	r := make([]core.RegularExpression, 0)
+	r = append(r, core.RegularExpression{
+		Find: "a(-b]+c",
+	})
+	configuration := core.Configuration{
+		RegularExpression: &r,
+	}
+	err := configuration.CompileRegularExpressions()
+	if err == nil {
+		t.Errorf("CompileRegularExpressions() expects error, got %v", err)
+	}
+}
+
+func Test_Process_RegularExpression_Flag_Array(t *testing.T) {
+	regexEmits, err := regexp.Compile(core.EmitsRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	regexFlag, err := regexp.Compile(core.EmitsFlagRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	n := core.FileNode{
+		Line: &core.LineNode{
+			Value: ".keyword`flag:flag_value,foo:world` value",
+		},
+	}
+	_, err = n.Process(regexEmits, regexFlag)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+}
+
+func Test_Process_RegularExpression_Flag_String(t *testing.T) {
+	regexEmits, err := regexp.Compile(core.EmitsRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	regexFlag, err := regexp.Compile(core.EmitsFlagRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	n := core.FileNode{
+		Line: &core.LineNode{
+			Value: ".keyword`hello world` value",
+		},
+	}
+	_, err = n.Process(regexEmits, regexFlag)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+}
+
+func Test_File_Write_Error(t *testing.T){
 	n := core.EmitNode{}
 	err := n.Write("/null","/null", nil)
 	if err == nil {
-		t.Errorf("Write() expects error, got nil")
+		t.Errorf("Write() expects error, got nil")
+	}
+}
+
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func Test_WriteTo(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	var b strings.Builder
+	n, err := emits.File("", nil).WriteTo(&b)
+	if err != nil || n != int64(b.Len()) || !strings.Contains(b.String(), "\"keyword\":\"keyword\"") {
+		t.Errorf("WriteTo() expects %v bytes of EmitFile, got %v: %v", b.Len(), n, err)
+	}
+	b.Reset()
+	n, err = f.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) || !strings.Contains(b.String(), "\"value\":\".keyword value\"") {
+		t.Errorf("WriteTo() expects %v bytes of FileNode, got %v: %v", b.Len(), n, err)
+	}
+	_, err = emits.File("", nil).WriteTo(errorWriter{})
+	if err == nil {
+		t.Errorf("WriteTo() expects error, got nil")
+	}
+}
+
+func Test_Process_RegularExpression_Flag_Empty(t *testing.T) {
+	regexEmits, err := regexp.Compile(core.EmitsRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	regexFlag, err := regexp.Compile(core.EmitsFlagRegex)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	n := core.FileNode{
+		Line: &core.LineNode{
+			Value: ".keyword`flag:flag_value,,foo,` value",
+		},
+	}
+	e, err := n.Process(regexEmits, regexFlag)
+	if err != nil {
+		t.Errorf("Process() expects nil, got %v", err)
+	}
+	if len(e.Flag) != 2 {
+		t.Errorf("Process() expects 2 flags, got %v", len(e.Flag))
+	}
+	for _, f := range e.Flag {
+		if len(f.Name) == 0 && len(f.Value) == 0 {
+			t.Errorf("Process() expects no empty flags, got %v", e.Flag)
+		}
+	}
+}
+
+func Test_EmitFile_WriteCanonical(t *testing.T) {
+	var canonical []string
+	for i := 0; i < 2; i++ {
+		f := &core.FileNode{}
+		_, err := f.Build("core.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("Build() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		var b strings.Builder
+		err = emits.File("", nil).WriteCanonical(&b)
+		if err != nil {
+			t.Errorf("WriteCanonical() expects nil, got %s", err)
+		}
+		canonical = append(canonical, b.String())
+	}
+	if canonical[0] != canonical[1] {
+		t.Errorf("WriteCanonical() expects identical output")
+	}
+	if !strings.Contains(canonical[0], "\n  \"data\": [") || !strings.Contains(canonical[0], "\"timestamp\": \"\"") {
+		t.Errorf("WriteCanonical() expects indented output without timestamp, got %v", canonical[0][:64])
+	}
+}
+
+func Test_Emit_ContentHash(t *testing.T) {
+	hash := func(data string) string {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader(data), "main.go", &core.Configuration{
+			EmitContentHash: true,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		return emits.Data[len(emits.Data)-1].ContentHash
+	}
+	h := hash("// .keyword`flag:value` value\n")
+	if len(h) == 0 {
+		t.Errorf("ContentHash expects a hash, got empty")
+	}
+	if moved := hash("// other\n// .keyword`flag:value` value\n"); moved != h {
+		t.Errorf("ContentHash expects %v when the line number shifts, got %v", h, moved)
+	}
+	if changed := hash("// .keyword`flag:value` changed\n"); changed == h {
+		t.Errorf("ContentHash expects a different hash when the value changes")
+	}
+	nested := func(flag ...*core.EmitFlag) string {
+		e := &core.EmitNode{
+			Keyword: "keyword",
+			Flag:    flag,
+		}
+		return e.Hash()
+	}
+	a := nested(&core.EmitFlag{Name: "author", Flag: []*core.EmitFlag{{Name: "name", Value: "a"}}})
+	if b := nested(&core.EmitFlag{Name: "author", Flag: []*core.EmitFlag{{Name: "name", Value: "b"}}}); a == b {
+		t.Errorf("Hash() expects a different hash when a nested flag changes, got %v", b)
+	}
+	if depth := nested(&core.EmitFlag{Name: "author"}, &core.EmitFlag{Name: "name", Value: "a"}); a == depth {
+		t.Errorf("Hash() expects a different hash when a flag is not nested, got %v", depth)
+	}
+}
+
+func Test_Emit_Coalesce_ValueJoin(t *testing.T) {
+	for join, expects := range map[string]string{
+		"":  "first\nsecond\nthird",
+		" ": "first second third",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .description first\n  // second\n  // third\n  // .keyword nested\n"), "main.go", &core.Configuration{
+			Coalesce:  true,
+			ValueJoin: join,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		if emits.Data[0].Value != expects {
+			t.Errorf("Emit() expects coalesced value %q, got %q", expects, emits.Data[0].Value)
+		}
+		if len(emits.Data[0].Data) != 1 || emits.Data[0].Data[0].Keyword != "keyword" {
+			t.Errorf("Emit() expects the keyword child to remain, got %v", emits.Data[0].Data)
+		}
+	}
+}
+
+func Test_BuildReader_Offset(t *testing.T) {
+	data := "package main\r\n\t// .keyword value\n/*  block */\n"
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader(data), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	var lines []*core.LineNode
+	var walk func(n *core.FileNode)
+	walk = func(n *core.FileNode) {
+		if n.Line.IsCommentOrExposed() {
+			lines = append(lines, n.Line)
+		}
+		for _, c := range n.Child {
+			walk(c)
+		}
+	}
+	walk(f)
+	if len(lines) != 2 {
+		t.Fatalf("BuildReader() expects 2 lines, got %v", len(lines))
+	}
+	for _, l := range lines {
+		start := l.StartOffset + l.ValueColumn
+		if data[start:start+len(l.Value)] != l.Value {
+			t.Errorf("StartOffset and ValueColumn expect %q, got %q", l.Value, data[start:start+len(l.Value)])
+		}
+	}
+	if lines[0].StartOffset != 14 || lines[0].ValueColumn != 4 {
+		t.Errorf("StartOffset and ValueColumn expect 14 and 4, got %v and %v", lines[0].StartOffset, lines[0].ValueColumn)
+	}
+}
+
+func Test_Emit_LineRange(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .parent value\n  // .child value\n    // .grandchild value\n// .sibling value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if emits.Data[0].LineStart != 1 || emits.Data[0].LineEnd != 3 {
+		t.Errorf("Emit() expects parent range 1-3, got %v-%v", emits.Data[0].LineStart, emits.Data[0].LineEnd)
+	}
+	if emits.Data[1].LineStart != 4 || emits.Data[1].LineEnd != 4 {
+		t.Errorf("Emit() expects sibling range 4-4, got %v-%v", emits.Data[1].LineStart, emits.Data[1].LineEnd)
+	}
+}
+
+func Test_Emit_MinSeverity(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .issue`severity:debug` low\n// .issue`severity:warning` medium\n// .issue`severity:critical` high\n// .issue none\n// plain\n"), "main.go", &core.Configuration{
+		MinSeverity: "warning",
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	var values []string
+	for _, d := range emits.Data {
+		values = append(values, d.Value)
+	}
+	if strings.Join(values, ",") != "medium,high,none,plain" {
+		t.Errorf("Emit() expects medium,high,none,plain, got %v", values)
+	}
+}
+
+func Test_BuildAndEmit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	err := os.WriteFile(path, []byte("// .keyword value\n/*\nfunc main() {}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := []*core.MetaData{
+		{
+			Keyword: "layout",
+			Value:   "foo",
+		},
+	}
+	result, err := core.BuildAndEmit(path, &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	}, m)
+	if err != nil {
+		t.Fatalf("BuildAndEmit() expects nil, got %s", err)
+	}
+	if result.FileNode == nil || result.EmitNode == nil || result.EmitFile == nil {
+		t.Errorf("BuildAndEmit() expects FileNode, EmitNode, and EmitFile, got %v", result)
+	}
+	if result.EmitFile.Meta.File != path || len(result.EmitFile.Meta.Data) != 1 || len(result.EmitFile.Data) != 3 {
+		t.Errorf("BuildAndEmit() expects EmitFile for %v, got %v", path, result.EmitFile.Meta)
+	}
+	if len(result.Diagnostic) != 1 {
+		t.Errorf("BuildAndEmit() expects 1 diagnostic, got %v", result.Diagnostic)
+	}
+	if result.BuildDuration <= 0 || result.EmitDuration <= 0 {
+		t.Errorf("BuildAndEmit() expects durations, got %v and %v", result.BuildDuration, result.EmitDuration)
+	}
+}
+
+func Test_Emit_EmitsPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "@", ":", "$", "*."} {
+		p := prefix
+		if len(p) == 0 {
+			p = core.DefaultEmitsPrefix
+		}
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// "+p+"keyword`flag:value` value\n// .other value\n"), "main.go", &core.Configuration{
+			EmitsPrefix: prefix,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		if emits.Data[0].Keyword != "keyword" || emits.Data[0].Value != "value" {
+			t.Errorf("Emit() expects keyword with prefix %q, got %v", p, emits.Data[0])
+		}
+		if len(prefix) > 0 && len(emits.Data[1].Keyword) > 0 {
+			t.Errorf("Emit() expects no keyword without prefix %q, got %v", p, emits.Data[1].Keyword)
+		}
+	}
+}
+
+func Test_Emit_FlagSplit(t *testing.T) {
+	// Quotes are kept unless FlagUnquote, see Test_Configuration_FlagUnquote
+	for flagSplit, c := range map[string]struct {
+		data     string
+		value    string
+		unquoted string
+	}{
+		";":  {"// .keyword`value:1,2,3;name:foo` value\n", "1,2,3", "1,2,3"},
+		"":   {"// .keyword`value:\"1,2,3\",name:foo` value\n", `"1,2,3"`, "1,2,3"},
+		"||": {"// .keyword`value:\"1||2\"||name:foo` value\n", `"1||2"`, "1||2"},
+	} {
+		for _, unquote := range []bool{false, true} {
+			f := &core.FileNode{}
+			_, err := f.BuildReader(strings.NewReader(c.data), "main.go", &core.Configuration{
+				FlagSplit:   flagSplit,
+				FlagUnquote: unquote,
+				Comment: &core.Comment{
+					Line: "//",
+					Block: &core.CommentBlock{
+						Start: "/*",
+						End:   "*/",
+					},
+				},
+			})
+			if err != nil {
+				t.Errorf("BuildReader() expects nil, got %s", err)
+			}
+			emits, err := f.Emit()
+			if err != nil {
+				t.Errorf("Emit() expects nil, got %s", err)
+			}
+			value := c.value
+			if unquote {
+				value = c.unquoted
+			}
+			flag := emits.Data[0].Flag
+			if len(flag) != 2 || flag[0].Name != "value" || flag[0].Value != value || flag[1].Name != "name" || flag[1].Value != "foo" {
+				t.Errorf("Emit() expects value %v and name foo split by %q, got %v", value, flagSplit, flag)
+			}
+		}
+	}
+}
+
+func Test_Emit_InheritFlags(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .package`module:auth,owner:me` value\n  // .func login\n  // .func`module:session` refresh\n    // .param token\n"), "main.go", &core.Configuration{
+		InheritFlags: []string{"module"},
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	module := func(e *core.EmitNode) string {
+		var values []string
+		for _, flag := range e.Flag {
+			if flag.Name == "module" {
+				values = append(values, flag.Value)
+			}
+			if flag.Name == "owner" && e.Keyword != "package" {
+				t.Errorf("Emit() expects owner not to be inherited by %v", e.Keyword)
+			}
+		}
+		return strings.Join(values, ",")
+	}
+	p := emits.Data[0]
+	if m := module(p.Data[0]); m != "auth" {
+		t.Errorf("Emit() expects login module auth, got %v", m)
+	}
+	if m := module(p.Data[1]); m != "session" {
+		t.Errorf("Emit() expects refresh module session, got %v", m)
+	}
+	if m := module(p.Data[1].Data[0]); m != "session" {
+		t.Errorf("Emit() expects token module session, got %v", m)
+	}
+}
+
+func Test_EmitNode_Select(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .issue`status:open` first\n  // .issue`status:closed` second\n  // .issue`status:open` third\n// .issue fourth\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	selected := emits.Select(func(flags []*core.EmitFlag) bool {
+		for _, flag := range flags {
+			if flag.Name == "status" && flag.Value == "open" {
+				return true
+			}
+		}
+		return false
+	})
+	if len(selected) != 2 || selected[0].Value != "first" || selected[1].Value != "third" {
+		t.Errorf("Select() expects first and third, got %v", selected)
+	}
+}
+
+func Test_Walk(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .a first\n  // .b second\n    // .c third\n// .d fourth\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	var lines []int
+	err = f.Walk(func(n *core.FileNode) error {
+		if n.Line != nil {
+			lines = append(lines, n.Line.Number)
+		}
+		return nil
+	})
+	if err != nil || fmt.Sprint(lines) != "[1 2 3 4]" {
+		t.Errorf("Walk() expects [1 2 3 4], got %v, %v", lines, err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	var keywords []string
+	err = emits.Walk(func(e *core.EmitNode) error {
+		keywords = append(keywords, e.Keyword)
+		return nil
+	})
+	if err != nil || strings.Join(keywords, ",") != ",a,b,c,d" {
+		t.Errorf("Walk() expects ,a,b,c,d, got %v, %v", keywords, err)
+	}
+}
+
+func Test_Walk_Error(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .a first\n  // .b second\n    // .c third\n// .d fourth\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	stop := errors.New("stop")
+	visited := 0
+	err = f.Walk(func(n *core.FileNode) error {
+		visited++
+		if n.Line != nil && n.Line.Number == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 3 {
+		t.Errorf("Walk() expects stop after 3 nodes, got %v after %v", err, visited)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	visited = 0
+	err = emits.Walk(func(e *core.EmitNode) error {
+		visited++
+		if e.Keyword == "c" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 4 {
+		t.Errorf("Walk() expects stop after 4 nodes, got %v after %v", err, visited)
+	}
+}
+
+func Test_EmitNode_Find(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function foo\n  // .param a\n  // .Param b\n    // .param c\n// .function bar\n  // .param d\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	values := func(nodes []*core.EmitNode) string {
+		var v []string
+		for _, n := range nodes {
+			v = append(v, n.Value)
+		}
+		return strings.Join(v, ",")
+	}
+	if found := emits.Find("param"); values(found) != "a,c,d" {
+		t.Errorf("Find() expects a,c,d, got %v", values(found))
+	}
+	if found := emits.FindFold("PARAM"); values(found) != "a,b,c,d" {
+		t.Errorf("FindFold() expects a,b,c,d, got %v", values(found))
+	}
+	if found := emits.Find("missing"); len(found) != 0 {
+		t.Errorf("Find() expects none, got %v", values(found))
+	}
+	if found := emits.FindFirst("Param"); found == nil || found.Value != "b" {
+		t.Errorf("FindFirst() expects b, got %v", found)
+	}
+	if found := emits.FindFirstFold("param"); found == nil || found.Value != "a" {
+		t.Errorf("FindFirstFold() expects a, got %v", found)
+	}
+	if found := emits.Data[0].FindFirst("function"); found != nil {
+		t.Errorf("FindFirst() expects nil, got %v", found)
+	}
+}
+
+func Test_EmitNode_FlagValue(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword`status:open,status:closed,empty:` value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	e := emits.Data[0]
+	if value, ok := e.FlagValue("status"); !ok || value != "open" {
+		t.Errorf("FlagValue() expects the first value open, got %v, %v", value, ok)
+	}
+	if value, ok := e.FlagValue("empty"); !ok || len(value) > 0 {
+		t.Errorf("FlagValue() expects an empty value, got %v, %v", value, ok)
+	}
+	if value, ok := e.FlagValue("missing"); ok || len(value) > 0 {
+		t.Errorf("FlagValue() expects not found, got %v, %v", value, ok)
+	}
+	if !e.HasFlag("status") || !e.HasFlag("empty") || e.HasFlag("missing") {
+		t.Errorf("HasFlag() expects status and empty only, got %v", e.Flag)
+	}
+}
+
+func Test_EmitNode_KeywordCounts(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function foo\n  // .param a\n  // plain value\n    // .param b\n// .function bar\n  // .return c\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	counts := emits.KeywordCounts()
+	if len(counts) != 3 || counts["function"] != 2 || counts["param"] != 2 || counts["return"] != 1 {
+		t.Errorf("KeywordCounts() expects function 2, param 2 and return 1, got %v", counts)
+	}
+}
+
+func Test_Emit_Flag_Escape(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword`foo:a\\,b,foo\\:bar:value,path:c:\\\\dir\\\\,plain\\,text` value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	flag := emits.Data[0].Flag
+	if len(flag) != 4 {
+		t.Fatalf("Emit() expects 4 flags, got %v", len(flag))
+	}
+	expects := []core.EmitFlag{
+		{Name: "foo", Value: "a,b"},
+		{Name: "foo:bar", Value: "value"},
+		{Name: "path", Value: "c:\\dir\\"},
+		{Value: "plain,text"},
+	}
+	for i, e := range expects {
+		if flag[i].Name != e.Name || flag[i].Value != e.Value {
+			t.Errorf("Emit() expects flag %v, got %v", e, *flag[i])
+		}
+	}
+}
+
+func Test_Emit_SplitValues(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .param name \"a string\"  required \"\"\n"), "main.go", &core.Configuration{
+		SplitValues: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	e := emits.Data[0]
+	if len(e.Values) != 4 || e.Values[0] != "name" || e.Values[1] != "a string" || e.Values[2] != "required" || e.Values[3] != "" {
+		t.Errorf("Emit() expects values [name, a string, required, ], got %q", e.Values)
+	}
+	if e.Value != "name \"a string\"  required \"\"" {
+		t.Errorf("Emit() expects the joined value to remain, got %v", e.Value)
+	}
+}
+
+func Test_Build_ValidateLineNumbers(t *testing.T) {
+	for _, renumber := range []bool{false, true} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .first value\n// .second value\n// .third value\n"), "main.go", &core.Configuration{
+			ValidateLineNumbers: true,
+			RenumberLines:       renumber,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			Plugin: &[]core.Plugin{
+				{
+					"./testdata/plugin/scramble.js",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		if len(f.Diagnostic) != 2 {
+			t.Errorf("ValidateLineNumbers() expects 2 diagnostics, got %v", len(f.Diagnostic))
+		}
+		var numbers []string
+		for _, c := range f.Child {
+			numbers = append(numbers, fmt.Sprint(c.Line.Number))
+		}
+		expects := "3,2,1"
+		if renumber {
+			expects = "1,2,3"
+		}
+		if strings.Join(numbers, ",") != expects {
+			t.Errorf("RenumberLines() expects %v, got %v", expects, numbers)
+		}
+	}
+}
+
+func Test_RenumberLines(t *testing.T) {
+	for numbers, expects := range map[string]string{
+		"5,4,3,2,1":   "1,2,3,4,5",
+		"10,20,5,30":  "10,20,21,30",
+		"1,30,2,3":    "1,2,3,4",
+		"4,8,15,16":   "4,8,15,16",
+		"9,1,2,3,4,5": "1,2,3,4,5,6",
+	} {
+		f := &core.FileNode{}
+		for _, n := range strings.Split(numbers, ",") {
+			number, _ := strconv.Atoi(n)
+			f.Insert(number, &core.LineNode{
+				CommentLine: true,
+			})
+		}
+		f.RenumberLines()
+		var actual []string
+		for _, c := range f.Child {
+			actual = append(actual, fmt.Sprint(c.Line.Number))
+		}
+		if strings.Join(actual, ",") != expects {
+			t.Errorf("RenumberLines() expects %v to be %v, got %v", numbers, expects, actual)
+		}
+	}
+}
+
+func Test_Build_ReEmitAfterPlugin(t *testing.T) {
+	for _, reEmit := range []bool{false, true} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .first value\n"), "main.go", &core.Configuration{
+			ReEmitAfterPlugin: reEmit,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			Plugin: &[]core.Plugin{
+				{
+					"./testdata/plugin/inject.js",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		if len(emits.Data) != 2 || emits.Data[0].Keyword != "first" {
+			t.Fatalf("Emit() expects the first and injected lines, got %v", emits.Data)
+		}
+		injected := emits.Data[1]
+		if reEmit && (injected.Keyword != "injected" || injected.Value != "value" || !f.Child[1].Line.CommentLine) {
+			t.Errorf("ReEmitAfterPlugin expects the injected keyword, got %q %q", injected.Keyword, injected.Value)
+		}
+		if !reEmit && len(injected.Keyword) > 0 {
+			t.Errorf("Emit() expects no injected keyword without ReEmitAfterPlugin, got %q", injected.Keyword)
+		}
+	}
+}
+
+func Test_Build_Plugin_Invalid(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first value\n  // .second value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/broken.js",
+			},
+		},
+	})
+	var buildErr *core.BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Err) != 1 {
+		t.Fatalf("BuildReader() expects a BuildError, got %v", err)
+	}
+	message := buildErr.Err[0].Error()
+	if !strings.Contains(message, "./testdata/plugin/broken.js") || !strings.Contains(message, "line 2 has parent 999, expected 1") {
+		t.Errorf("BuildReader() expects the plugin and the broken parent, got %v", message)
+	}
+	if len(f.Child) != 1 || f.Child[0].Child[0].ParentLine == 999 {
+		t.Errorf("BuildReader() expects the FileNode unchanged by the plugin, got %v", f.Child)
+	}
+}
+
+func Test_Build_Plugin_Parent(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first value\n  // .second value\n    // .third value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	last := f.LastNode()
+	if last.Line.Number != 3 || last.FirstNode() != f {
+		t.Errorf("FirstNode() expects the built FileNode, got %v", last.FirstNode())
+	}
+	if n := last.LastIndent(0); n == nil || n.Line.Number != 1 {
+		t.Errorf("LastIndent(0) expects line 1, got %v", n)
+	}
+	if address := last.Address(); address != "0/0/0" {
+		t.Errorf("Address() expects 0/0/0, got %v", address)
+	}
+}
+
+func Test_File_RelinkParents(t *testing.T) {
+	f := &core.FileNode{}
+	err := json.Unmarshal([]byte(`{"child":[{"line":{"number":1},"child":[{"line":{"number":2}}]}]}`), f)
+	if err != nil {
+		t.Fatalf("Unmarshal() expects nil, got %v", err)
+	}
+	f.RelinkParents()
+	if f.Child[0].Parent != f || f.Child[0].Child[0].Parent != f.Child[0] {
+		t.Errorf("RelinkParents() expects each Parent, got %v", f.Child[0].Child[0].Parent)
+	}
+}
+
+func Test_Build_MaxPluginOutputBytes(t *testing.T) {
+	for _, max := range []int{1024, 8192} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .first value\n"), "main.go", &core.Configuration{
+			MaxPluginOutputBytes: max,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			Plugin: &[]core.Plugin{
+				{
+					"./testdata/plugin/large.js",
+				},
+			},
+		})
+		if max == 1024 && (err == nil || !strings.Contains(err.Error(), "output exceeds the maximum of 1024 bytes")) {
+			t.Errorf("BuildReader() expects the plugin output to exceed 1024 bytes, got %v", err)
+		}
+		if max == 8192 && err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+	}
+}
+
+func Test_Build_PluginWorkingDir(t *testing.T) {
+	dir, err := filepath.Abs("testdata/plugin")
+	if err != nil {
+		t.Fatalf("Abs() expects nil, got %v", err)
+	}
+	f := &core.FileNode{}
+	_, err = f.BuildReader(strings.NewReader("// .first value\n"), "main.go", &core.Configuration{
+		PluginWorkingDir: "testdata/plugin",
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./cwd.js",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %s", err)
+	}
+	if len(f.Child) != 2 || f.Child[1].Line.Value != ".cwd "+dir {
+		t.Errorf("BuildReader() expects the plugin to run within %v, got %v", dir, f.Child)
+	}
+	temp, _ := filepath.Glob("testdata/plugin/_temp.*.json")
+	if len(temp) > 0 {
+		t.Errorf("BuildReader() expects the intermediate file removed, got %v", temp)
+	}
+}
+
+func Test_Build_DryRun(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first value\n  // .second value\n"), "main.go", &core.Configuration{
+		DryRun: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/inject.js",
+			},
+			{
+				"./missing.js",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %s", err)
+	}
+	if len(f.Child) != 1 {
+		t.Errorf("BuildReader() expects plugins skipped, got %v", f.Child)
+	}
+	intermediate := &core.FileNode{}
+	err = json.Unmarshal(f.Intermediate, intermediate)
+	if err != nil {
+		t.Fatalf("Unmarshal() expects nil, got %v", err)
+	}
+	if len(intermediate.Child) != 1 || intermediate.Child[0].Child[0].Line.Value != ".second value" || intermediate.Child[0].Child[0].ParentLine != 1 {
+		t.Errorf("BuildReader() expects the intermediate FileNode, got %s", f.Intermediate)
+	}
+}
+
+func Test_Build_PluginDiff(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first value\n// .second value\n// .third value\n"), "main.go", &core.Configuration{
+		PluginDiff: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/scramble.js",
+			},
+			{
+				"./testdata/plugin/remove.js",
+			},
+			{
+				"./testdata/plugin/inject.js",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildReader() expects nil, got %s", err)
+	}
+	var changes []string
+	for _, c := range f.PluginDiff {
+		changes = append(changes, fmt.Sprintf("%v %v %q %q", c.Line, c.Change, c.Before, c.After))
+	}
+	expects := []string{
+		`1 changed ".first value" ".third value"`,
+		`3 removed ".third value" ""`,
+		`100 added "" "  // .injected value"`,
+	}
+	if strings.Join(changes, ",") != strings.Join(expects, ",") {
+		t.Errorf("PluginDiff expects %v, got %v", expects, changes)
+	}
+}
+
+func Test_MergeEmitFiles(t *testing.T) {
+	var files []*core.EmitFile
+	for name, data := range map[string]string{
+		"a.go": "// .keyword a\n  // .child b\n",
+		"b.go": "// .keyword c\n// .keyword d\n",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader(data), name, &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		files = append(files, emits.File("", nil))
+	}
+	sort.Slice(files, func(a, b int) bool {
+		return files[a].Meta.File < files[b].Meta.File
+	})
+	merged := core.MergeEmitFiles(append(files, nil))
+	if len(merged.Data) != 3 {
+		t.Fatalf("MergeEmitFiles() expects 3 Data, got %v", len(merged.Data))
+	}
+	file := func(e *core.EmitNode) string {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Errorf("Marshal() expects nil, got %s", err)
+		}
+		var node struct {
+			File string `json:"file"`
+		}
+		json.Unmarshal(data, &node)
+		return node.File
+	}
+	if file(merged.Data[0]) != "a.go" || file(merged.Data[1]) != "b.go" || merged.Data[2].Value != "d" {
+		t.Errorf("MergeEmitFiles() expects Data tagged a.go, b.go, got %v, %v", file(merged.Data[0]), file(merged.Data[1]))
+	}
+	if len(merged.Data[0].Data) != 1 || len(file(files[0].Data[0])) > 0 || len(file(merged.Data[0].Data[0])) > 0 {
+		t.Errorf("MergeEmitFiles() expects children kept and sources unmodified, got %v", merged.Data[0].Data)
+	}
+	if len(merged.Meta.Source) != 2 || merged.Meta.Source[0].File != "a.go" || merged.Meta.Source[1].File != "b.go" {
+		t.Errorf("MergeEmitFiles() expects each source EmitMeta, got %v", merged.Meta.Source)
+	}
+	if len(merged.Meta.Timestamp) == 0 {
+		t.Errorf("MergeEmitFiles() expects a Timestamp, got empty")
+	}
+}
+
+func Test_EmitFile_Summary(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .func first\n  // .param a\n  // .param b\n// .func second\n// plain\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "summary.json")
+	err = emits.File("", nil).WriteSummary(path)
+	if err != nil {
+		t.Errorf("WriteSummary() expects nil, got %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := &core.FileSummary{}
+	err = json.Unmarshal(data, summary)
+	if err != nil {
+		t.Errorf("Unmarshal() expects nil, got %s", err)
+	}
+	if summary.File != "main.go" || summary.Directive != 4 || summary.Keyword["func"] != 2 || summary.Keyword["param"] != 2 || len(summary.Hash) != 64 {
+		t.Errorf("WriteSummary() expects counts matching the output, got %v", summary)
+	}
+}
+
+func Test_Emit_PrimaryKeyword(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword first\n// .title Headline\n// .keyword second\n// .title Again\n"), "main.go", &core.Configuration{
+		PrimaryKeyword: "title",
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	file := emits.File("", nil)
+	if file.Meta.Title != "Headline" {
+		t.Errorf("Emit() expects meta title Headline, got %v", file.Meta.Title)
+	}
+	if len(file.Data) != 3 || file.Data[1].Value != "second" {
+		t.Errorf("Emit() expects the primary directive removed from data, got %v", file.Data)
+	}
+	if len(f.Diagnostic) != 1 || f.Diagnostic[0].Line != 4 {
+		t.Errorf("Emit() expects a duplicate diagnostic on line 4, got %v", f.Diagnostic)
+	}
+	_, err = f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if len(f.Diagnostic) != 1 {
+		t.Errorf("Emit() expects the duplicate diagnostic once when emitted again, got %v", len(f.Diagnostic))
+	}
+}
+
+func Test_Emit_Diagnostic_Build(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .title Headline\n// .title Again\n/* .open\n"), "main.go", &core.Configuration{
+		PrimaryKeyword: "title",
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		if len(f.Diagnostic) != 2 || f.Diagnostic[0].Message != "unterminated comment block" || f.Diagnostic[1].Line != 2 {
+			t.Errorf("Emit() expects the Build diagnostic kept and the duplicate diagnostic replaced, got %v", f.Diagnostic)
+		}
+	}
+}
+
+func Test_EmitNode_Write_Gzip(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword`flag:value` value\n  // .child value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Now: func() time.Time {
+			return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	dir := t.TempDir()
+	for _, path := range []string{"main.json", "main.json.gz"} {
+		err = emits.Write("", filepath.Join(dir, path), nil)
+		if err != nil {
+			t.Errorf("Write() expects nil, got %s", err)
+		}
+	}
+	expects, err := os.ReadFile(filepath.Join(dir, "main.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(dir, "main.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("NewReader() expects a gzip stream, got %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll() expects nil, got %v", err)
+	}
+	if !bytes.Equal(data, expects) {
+		t.Errorf("Write() expects the decompressed output %s, got %s", expects, data)
+	}
+}
+
+func Test_EmitNode_WriteIndented(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword`flag:value` value\n  // .child value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.json")
+	err = emits.WriteIndented("", path, nil, "\t")
+	if err != nil {
+		t.Errorf("WriteIndented() expects nil, got %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\n\t\"meta\": {\n\t\t\"file\": \"main.go\"") || !strings.Contains(string(data), "\n\t\t\t\t\t\"keyword\": \"child\"") {
+		t.Errorf("WriteIndented() expects indented output, got %s", data)
+	}
+	file := &core.EmitFile{}
+	err = json.Unmarshal(data, file)
+	if err != nil || file.Data[0].Data[0].Keyword != "child" {
+		t.Errorf("WriteIndented() expects identical structure, got %v", err)
+	}
+}
+
+func Test_Emit_ExposeBlock(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .example Foo >\nfunc Foo() int {\n    return 1\n}\n// .keyword value\n"), "main.go", &core.Configuration{
+		Expose:      true,
+		ExposeBlock: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	if len(emits.Data) != 2 || emits.Data[0].Keyword != "example" || emits.Data[1].Keyword != "keyword" {
+		t.Fatalf("Emit() expects example and keyword, got %v", emits.Data)
+	}
+	if len(emits.Data[0].Data) != 1 {
+		t.Fatalf("Emit() expects a single code block, got %v", emits.Data[0].Data)
+	}
+	block := emits.Data[0].Data[0]
+	if block.Value != "func Foo() int {\n    return 1\n}" {
+		t.Errorf("Emit() expects the exposed code, got %q", block.Value)
+	}
+	if block.LineStart != 2 || block.LineEnd != 4 || emits.Data[0].LineEnd != 4 {
+		t.Errorf("Emit() expects range 2-4, got %v-%v", block.LineStart, block.LineEnd)
+	}
+}
+
+func Test_EmitNode_File_Timestamp(t *testing.T) {
+	e := &core.EmitNode{}
+	file := e.File("main.go", nil)
+	_, err := time.Parse(time.RFC3339, file.Meta.Timestamp)
+	if err != nil {
+		t.Errorf("File() expects an RFC3339 timestamp, got %v", file.Meta.Timestamp)
+	}
+}
+
+func Test_FileNode_EmitFile(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	file, err := f.EmitFile("", []*core.MetaData{
+		{
+			Keyword: "layout",
+			Value:   "foo",
+		},
+	})
+	if err != nil {
+		t.Errorf("EmitFile() expects nil, got %v", err)
+	}
+	if file.Meta.File != "main.go" || len(file.Meta.Data) != 1 || len(file.Meta.Timestamp) == 0 {
+		t.Errorf("EmitFile() expects assembled meta, got %v", file.Meta)
+	}
+	if len(file.Data) != 1 || file.Data[0].Keyword != "keyword" || file.Data[0].Value != "value" {
+		t.Errorf("EmitFile() expects emitted data, got %v", file.Data)
+	}
+	file, err = f.EmitFile("other.go", nil)
+	if err != nil || file.Meta.File != "other.go" {
+		t.Errorf("EmitFile() expects inputPath to override the Build name, got %v", file.Meta.File)
+	}
+}
+
+func Test_Configuration_Plugins(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"b.js":      0755,
+		"a.js":      0755,
+		"readme.md": 0644,
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte("#!/usr/bin/env node\n"), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Symbolic links are followed to executables, while broken links are skipped
+	target := filepath.Join(t.TempDir(), "c.js")
+	err := os.WriteFile(target, []byte("#!/usr/bin/env node\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"c.js": target,
+		"d.js": filepath.Join(dir, "missing.js"),
+	} {
+		err = os.Symlink(target, filepath.Join(dir, name))
+		if err != nil {
+			t.Skipf("Symlink() is not supported: %v", err)
+		}
+	}
+	configuration := &core.Configuration{
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+			{
+				"./testdata/plugin/bar.js",
+			},
+		},
+		PluginDirectory: []string{dir},
+	}
+	plugins, err := configuration.Plugins()
+	if err != nil {
+		t.Errorf("Plugins() expects nil, got %v", err)
+	}
+	var paths []string
+	for _, p := range plugins {
+		paths = append(paths, p.Path)
+	}
+	expects := []string{"./testdata/plugin/foo.js", "./testdata/plugin/bar.js", filepath.Join(dir, "a.js"), filepath.Join(dir, "b.js"), filepath.Join(dir, "c.js")}
+	if strings.Join(paths, ",") != strings.Join(expects, ",") {
+		t.Errorf("Plugins() expects %v, got %v", expects, paths)
+	}
+}
+
+func Test_Configuration_Now(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Now: func() time.Time {
+			return time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	file := emits.File("", nil)
+	if file.Meta.Timestamp != "2020-01-02T02:04:05Z" {
+		t.Errorf("File() expects 2020-01-02T02:04:05Z, got %v", file.Meta.Timestamp)
+	}
+}
+
+func Test_Configuration_MetaKeyword(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .meta author Jane Doe\n// .meta draft\n// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		MetaKeyword: "meta",
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(emits.Data) != 1 || emits.Data[0].Keyword != "keyword" {
+		t.Errorf("Emit() expects only the keyword EmitNode, got %v", emits.Data)
+	}
+	file := emits.File("", []*core.MetaData{{Keyword: "version", Value: "1"}})
+	if len(file.Meta.Data) != 3 {
+		t.Fatalf("File() expects 3 MetaData, got %v", len(file.Meta.Data))
+	}
+	if file.Meta.Data[0].Keyword != "author" || file.Meta.Data[0].Value != "Jane Doe" {
+		t.Errorf("File() expects author Jane Doe, got %v %v", file.Meta.Data[0].Keyword, file.Meta.Data[0].Value)
+	}
+	if file.Meta.Data[1].Keyword != "draft" || len(file.Meta.Data[1].Value) > 0 {
+		t.Errorf("File() expects draft, got %v %v", file.Meta.Data[1].Keyword, file.Meta.Data[1].Value)
+	}
+	if file.Meta.Data[2].Keyword != "version" {
+		t.Errorf("File() expects version, got %v", file.Meta.Data[2].Keyword)
+	}
+}
+
+func Test_Configuration_SymbolPattern(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function returns foo\n\nfunc Foo() {\n}\n// .note unattached\nvar x = 1\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		SymbolPattern: `^func\s+(\w+)`,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(emits.Data) != 2 {
+		t.Fatalf("Emit() expects 2 Data, got %v", len(emits.Data))
+	}
+	if len(emits.Data[0].Flag) != 1 || emits.Data[0].Flag[0].Name != "symbol" || emits.Data[0].Flag[0].Value != "Foo" {
+		t.Errorf("Emit() expects symbol:Foo, got %v", emits.Data[0].Flag)
+	}
+	if len(emits.Data[1].Flag) != 0 {
+		t.Errorf("Emit() expects no flags, got %v", emits.Data[1].Flag)
+	}
+}
+
+func Test_Configuration_SymbolPattern_Error(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function returns foo\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		SymbolPattern: `(`,
+	})
+	if err == nil {
+		t.Errorf("BuildReader() expects error, got nil")
+	}
+}
+
+func Test_DefaultConfiguration(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("package main\n\n// .function main\n/*\n.note entry point\n*/\nfunc main() {}\n"), "main.go", core.DefaultConfiguration())
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	var keywords []string
+	for _, d := range emits.Data {
+		if len(d.Keyword) > 0 {
+			keywords = append(keywords, d.Keyword)
+		}
+	}
+	if strings.Join(keywords, ",") != "function,note" {
+		t.Errorf("Emit() expects function,note, got %v", keywords)
+	}
+}
+
+func Test_GoConfiguration(t *testing.T) {
+	c := core.GoConfiguration()
+	if c.Language != "go" {
+		t.Errorf("GoConfiguration() expects go, got %v", c.Language)
+	}
+	if c.Comment == nil || c.Comment.Line != "//" {
+		t.Errorf("GoConfiguration() expects // line comments, got %v", c.Comment)
+	}
+}
+
+func Test_Build_Configuration_Error(t *testing.T) {
+	for _, c := range []*core.Configuration{
+		nil,
+		{},
+		{
+			Comment: &core.Comment{
+				Line: "//",
+			},
+		},
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "file.unknown", c)
+		if err == nil || !strings.Contains(err.Error(), "configuration") {
+			t.Errorf("Build() expects configuration error, got %v", err)
+		}
+	}
+}
+
+func Test_EmitNode_AppendNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emits.ndjson")
+	for _, batch := range []string{"// .first one\n// .second two\n", "// .third three\n"} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader(batch), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		err = emits.AppendNDJSON(path, nil)
+		if err != nil {
+			t.Errorf("AppendNDJSON() expects nil, got %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keywords []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		record := &core.EmitRecord{}
+		err = json.Unmarshal([]byte(line), record)
+		if err != nil {
+			t.Fatalf("AppendNDJSON() expects JSON lines, got %v", line)
+		}
+		if record.Meta == nil || record.Meta.File != "main.go" {
+			t.Errorf("AppendNDJSON() expects main.go meta, got %v", record.Meta)
+		}
+		keywords = append(keywords, record.Data.Keyword)
+	}
+	if strings.Join(keywords, ",") != "first,second,third" {
+		t.Errorf("AppendNDJSON() expects first,second,third, got %v", keywords)
+	}
+}
+
+func Test_Configuration_Validate(t *testing.T) {
+	err := core.DefaultConfiguration().Validate()
+	if err != nil {
+		t.Errorf("Validate() expects nil, got %v", err)
+	}
+	c := &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start:     `"""`,
+				End:       `"""`,
+				Symmetric: true,
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
+	}
+	err = c.Validate()
+	if err != nil {
+		t.Errorf("Validate() expects nil, got %v", err)
+	}
+}
+
+func Test_Configuration_Validate_Error(t *testing.T) {
+	for name, test := range map[string]struct {
+		configuration *core.Configuration
+		expects       string
+	}{
+		"comment": {
+			&core.Configuration{},
+			"comment is nil",
+		},
+		"empty": {
+			&core.Configuration{
+				Comment: &core.Comment{
+					Block: &core.CommentBlock{
+						End: "*/",
+					},
+				},
+			},
+			"comment block start is empty",
+		},
+		"disabled": {
+			&core.Configuration{
+				Comment: &core.Comment{
+					Block: &core.CommentBlock{},
+				},
+			},
+			"comment line and block are empty",
+		},
+		"symmetric": {
+			&core.Configuration{
+				Comment: &core.Comment{
+					Line: "#",
+					Block: &core.CommentBlock{
+						Start: `"""`,
+						End:   `"""`,
+					},
+				},
+			},
+			"comment block start and end are both",
+		},
+		"plugin": {
+			&core.Configuration{
+				Comment: &core.Comment{
+					Line: "//",
+					Block: &core.CommentBlock{
+						Start: "/*",
+						End:   "*/",
+					},
+				},
+				Plugin: &[]core.Plugin{
+					{
+						"./missing.js",
+					},
+					{
+						"./core.go",
+					},
+				},
+			},
+			"plugin ./core.go is not executable",
+		},
+		"regular expression": {
+			&core.Configuration{
+				Comment: &core.Comment{
+					Line: "//",
+					Block: &core.CommentBlock{
+						Start: "/*",
+						End:   "*/",
+					},
+				},
+				RegularExpression: &[]core.RegularExpression{
+					{
+						Find: "a(",
+					},
+				},
+				LineTagPattern: "b(",
+			},
+			"missing closing ): `b(`",
+		},
+	} {
+		err := test.configuration.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.expects) {
+			t.Errorf("Validate() expects %v error containing %v, got %v", name, test.expects, err)
+		}
+	}
+}
+
+func Test_BuildReader_Expose_Warning(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .example usage >\n\nfoo()\n\n\nbar()\n// .example other >\nbaz()\n\n"), "main.go", &core.Configuration{
+		Expose: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	if len(f.Diagnostic) != 1 || f.Diagnostic[0].Severity != core.DiagnosticWarning || f.Diagnostic[0].Line != 2 {
+		t.Errorf("BuildReader() expects a warning on line 2 only, as blank lines within exposed code are expected, got %v", f.Diagnostic)
+	}
+}
+
+func Test_Configuration_RootKeyword(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first one\n// .second two\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RootKeyword: "file",
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(emits.Data) != 1 {
+		t.Fatalf("Emit() expects 1 Data, got %v", len(emits.Data))
+	}
+	root := emits.Data[0]
+	if root.Keyword != "file" || len(root.Flag) != 1 || root.Flag[0].Name != "file" || root.Flag[0].Value != "main.go" {
+		t.Errorf("Emit() expects file keyword with file:main.go, got %v %v", root.Keyword, root.Flag)
+	}
+	if len(root.Data) != 2 || root.Data[0].Keyword != "first" || root.Data[1].Keyword != "second" {
+		t.Errorf("Emit() expects first and second within root, got %v", root.Data)
+	}
+	if root.LineStart != 1 || root.LineEnd != 2 {
+		t.Errorf("Emit() expects lines 1-2, got %v-%v", root.LineStart, root.LineEnd)
+	}
+}
+
+func Test_PresetConfiguration(t *testing.T) {
+	for language, data := range map[string]string{
+		"go":     "// .keyword value\n/*\n.block value\n*/\n",
+		"c":      "// .keyword value\n/* .block value */\n",
+		"python": "# .keyword value\nx = '*/'\n# .block value\n",
+		"ruby":   "# .keyword value\n=begin\n.block value\n=end\n",
+		"html":   "<p>// .ignored value</p>\n<!-- .keyword value -->\n<!--\n.block value\n-->\n",
+		"sql":    "-- .keyword value\n/* .block value */\n",
+		"lua":    "-- .keyword value\n--[[\n.block value\n]]\n",
+	} {
+		c, err := core.PresetConfiguration(language)
+		if err != nil {
+			t.Fatalf("PresetConfiguration() expects nil, got %v", err)
+		}
+		err = c.Validate()
+		if err != nil {
+			t.Errorf("Validate() expects %v preset to be valid, got %v", language, err)
+		}
+		f := &core.FileNode{}
+		_, err = f.BuildReader(strings.NewReader(data), "file", c)
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		var keywords []string
+		for _, d := range emits.Data {
+			if len(d.Keyword) > 0 {
+				keywords = append(keywords, d.Keyword)
+			}
+		}
+		if strings.Join(keywords, ",") != "keyword,block" {
+			t.Errorf("Emit() expects %v keyword,block, got %v", language, keywords)
+		}
+	}
+}
+
+func Test_PresetConfiguration_Error(t *testing.T) {
+	_, err := core.PresetConfiguration("cobol")
+	if err == nil || !strings.Contains(err.Error(), "go, html") {
+		t.Errorf("PresetConfiguration() expects error listing supported languages, got %v", err)
+	}
+}
+
+func Test_CommentForExtension(t *testing.T) {
+	for ext, line := range map[string]string{
+		".go":  "//",
+		".PY":  "#",
+		".rb":  "#",
+		".sql": "--",
+	} {
+		comment := core.CommentForExtension(ext)
+		if comment == nil || comment.Line != line {
+			t.Errorf("CommentForExtension() expects %v for %v, got %v", line, ext, comment)
+		}
+	}
+	if comment := core.CommentForExtension(".unknown"); comment != nil {
+		t.Errorf("CommentForExtension() expects nil, got %v", comment)
+	}
+}
+
+func Test_Build_CommentForExtension(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("# .keyword value\n"), "main.py", &core.Configuration{})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(emits.Data) != 1 || emits.Data[0].Keyword != "keyword" {
+		t.Errorf("Emit() expects keyword, got %v", emits.Data)
+	}
+}
+
+func Test_Configuration_FlagUnquote(t *testing.T) {
+	for unquote, expects := range map[bool][]string{
+		false: {`"Hello, World"`, `"a:b"`, "plain"},
+		true:  {"Hello, World", "a:b", "plain"},
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword`name:\"Hello, World\",other:\"a:b\",plain` value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			FlagUnquote: unquote,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		flags := emits.Data[0].Flag
+		if len(flags) != len(expects) {
+			t.Fatalf("Emit() expects %v flags, got %v", len(expects), len(flags))
+		}
+		for i, flag := range flags {
+			if flag.Value != expects[i] {
+				t.Errorf("Emit() expects %v with FlagUnquote %v, got %v", expects[i], unquote, flag.Value)
+			}
+		}
+	}
+}
+
+func Test_FileNode_Address(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first one\n  // .nested two\n  // .nested three\n    // .deep four\n// .second five\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	deep := f.Child[0].Child[1].Child[0]
+	if deep.Address() != "0/1/0" {
+		t.Errorf("Address() expects 0/1/0, got %v", deep.Address())
+	}
+	if f.NodeAt("0/1/0") != deep {
+		t.Errorf("NodeAt() expects the node at 0/1/0, got %v", f.NodeAt("0/1/0"))
+	}
+	if deep.NodeAt("1").Line.Value != ".second five" {
+		t.Errorf("NodeAt() expects .second five, got %v", deep.NodeAt("1").Line.Value)
+	}
+	if f.NodeAt("") != f || len(f.Address()) > 0 {
+		t.Errorf("NodeAt() expects the first FileNode for an empty address")
+	}
+	for _, address := range []string{"2", "0/x", "0/-1"} {
+		if n := f.NodeAt(address); n != nil {
+			t.Errorf("NodeAt() expects nil for %v, got %v", address, n)
+		}
+	}
+}
+
+func Test_Configuration_RegexTimeout(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword "+strings.Repeat("a ", 1<<18)+"\n// .other value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:    `((\w+\s*)+)+(x|y|z)?`,
+				Replace: "$1",
+			},
+		},
+		RegexTimeout: time.Nanosecond,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	if len(f.Diagnostic) == 0 || f.Diagnostic[0].Line != 1 || !strings.Contains(f.Diagnostic[0].Message, "exceeded") {
+		t.Errorf("BuildReader() expects a timeout Diagnostic on line 1, got %v", f.Diagnostic)
+	}
+}
+
+func Test_Configuration_RegexTimeout_RegexAfterEmit(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword "+strings.Repeat("a ", 1<<18)+"\n// .other value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:    `((\w+\s*)+)+(x|y|z)?`,
+				Replace: "$1",
+			},
+		},
+		RegexTimeout:   time.Nanosecond,
+		RegexAfterEmit: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(f.Diagnostic) == 0 || f.Diagnostic[0].Line != 1 || !strings.Contains(f.Diagnostic[0].Message, "exceeded") {
+		t.Errorf("Emit() expects a timeout Diagnostic on line 1, got %v", f.Diagnostic)
+	}
+	if emits.Data[0].Value != strings.TrimSpace(strings.Repeat("a ", 1<<18)) {
+		t.Errorf("Emit() expects the timed out replacement skipped")
+	}
+}
+
+func Test_Configuration_MaxRegexCount(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find: "a",
+			},
+			{
+				Find: "b",
+			},
+		},
+		MaxRegexCount: 1,
+	})
+	if err == nil || !strings.Contains(err.Error(), "maximum of 1") {
+		t.Errorf("BuildReader() expects maximum error, got %v", err)
+	}
+}
+
+func Test_Configuration_Matches(t *testing.T) {
+	c := &core.Configuration{
+		Include: []string{"*.go", "docs/**/*.md"},
+		Exclude: []string{"**/testdata/**", "*_test.go", "vendor/**"},
+	}
+	for path, expects := range map[string]bool{
+		"main.go":                 true,
+		"pkg/lib.go":              true,
+		"pkg/lib_test.go":         false,
+		"pkg/testdata/fixture.go": false,
+		"vendor/dep/dep.go":       false,
+		"docs/readme.md":          true,
+		"docs/api/v1/readme.md":   true,
+		"readme.md":               false,
+		"pkg/lib.js":              false,
+	} {
+		if c.Matches(path) != expects {
+			t.Errorf("Matches() expects %v for %v, got %v", expects, path, !expects)
+		}
+	}
+	if !(&core.Configuration{}).Matches("any/path.txt") {
+		t.Errorf("Matches() expects true without Include")
+	}
+}
+
+func Test_Configuration_NestedFlags(t *testing.T) {
+	for nested, expects := range map[bool]int{
+		false: 3,
+		true:  2,
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword`author:{name:me,contact:{email:x}},draft` value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			NestedFlags: nested,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		flags := emits.Data[0].Flag
+		if len(flags) != expects {
+			t.Errorf("Emit() expects %v flags with NestedFlags %v, got %v", expects, nested, len(flags))
+		}
+		if !nested {
+			continue
+		}
+		author := flags[0]
+		if author.Name != "author" || len(author.Value) > 0 || len(author.Flag) != 2 {
+			t.Fatalf("Emit() expects author with 2 nested flags, got %v", author)
+		}
+		if author.Flag[0].Name != "name" || author.Flag[0].Value != "me" {
+			t.Errorf("Emit() expects name:me, got %v:%v", author.Flag[0].Name, author.Flag[0].Value)
+		}
+		contact := author.Flag[1]
+		if contact.Name != "contact" || len(contact.Flag) != 1 || contact.Flag[0].Name != "email" || contact.Flag[0].Value != "x" {
+			t.Errorf("Emit() expects contact with email:x, got %v", contact)
+		}
+		if flags[1].Value != "draft" {
+			t.Errorf("Emit() expects draft, got %v", flags[1].Value)
+		}
+	}
+}
+
+func Test_Configuration_EmitSource(t *testing.T) {
+	for _, source := range []bool{false, true} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("\n// .keyword value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			EmitSourceLine: source,
+			EmitSourceFile: source,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		data, err := json.Marshal(emits.Data[0])
+		if err != nil {
+			t.Errorf("Marshal() expects nil, got %v", err)
+		}
+		expects := `{"keyword":"keyword","value":"value","lineStart":2,"lineEnd":2}`
+		if source {
+			expects = `{"keyword":"keyword","value":"value","lineStart":2,"lineEnd":2,"line":2,"file":"main.go"}`
+		}
+		if string(data) != expects {
+			t.Errorf("Marshal() expects %v, got %v", expects, string(data))
+		}
+		data, err = xml.Marshal(emits.Data[0])
+		if err != nil {
+			t.Errorf("Marshal() expects nil, got %v", err)
+		}
+		if source != strings.Contains(string(data), ` line="2" file="main.go"`) {
+			t.Errorf("Marshal() expects line and file attributes %v, got %v", source, string(data))
+		}
+	}
+}
+
+func Test_EmitFile_Rows(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function`public,author:{name:me}` foo\n  // .param x\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		NestedFlags: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	rows := emits.File("", nil).Rows()
+	if len(rows) != 3 {
+		t.Fatalf("Rows() expects 3 rows, got %v", len(rows))
+	}
+	var got []string
+	for _, r := range rows {
+		name, value := "<nil>", "<nil>"
+		if r.FlagName != nil {
+			name, value = *r.FlagName, *r.FlagValue
+		}
+		got = append(got, fmt.Sprintf("%v:%v:%v:%v:%v:%v:%v", r.File, r.Line, r.Depth, r.Keyword, name, value, r.Value))
+	}
+	expects := []string{
+		"main.go:1:0:function::public:foo",
+		"main.go:1:0:function:author.name:me:foo",
+		"main.go:2:1:param:<nil>:<nil>:x",
+	}
+	if strings.Join(got, ",") != strings.Join(expects, ",") {
+		t.Errorf("Rows() expects %v, got %v", expects, got)
+	}
+}
+
+func Test_Configuration_SortFlags(t *testing.T) {
+	for sorted, expects := range map[bool]string{
+		false: "role:admin,author:me,role:user,:draft",
+		true:  ":draft,author:me,role:admin,role:user",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword`role:admin,author:me,role:user,draft` value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			SortFlags: sorted,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		var flags []string
+		for _, flag := range emits.Data[0].Flag {
+			flags = append(flags, flag.Name+":"+flag.Value)
+		}
+		if strings.Join(flags, ",") != expects {
+			t.Errorf("Emit() expects %v with SortFlags %v, got %v", expects, sorted, strings.Join(flags, ","))
+		}
+	}
+}
+
+func Test_Configuration_FlagDuplicatePolicy(t *testing.T) {
+	for policy, expects := range map[string]string{
+		"":                      "role:admin,author:me,role:user,:draft,:draft",
+		core.FlagDuplicateKeep:  "role:admin,author:me,role:user,:draft,:draft",
+		core.FlagDuplicateLast:  "author:me,role:user,:draft,:draft",
+		core.FlagDuplicateError: "could not process line 1: duplicate flag role",
+		"first":                 "could not process line 1: unknown flag duplicate policy first",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword`role:admin,author:me,role:user,draft,draft` value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			FlagDuplicatePolicy: policy,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			if err.Error() != expects {
+				t.Errorf("Emit() expects %v with %v, got %v", expects, policy, err)
+			}
+			continue
+		}
+		var flags []string
+		for _, flag := range emits.Data[0].Flag {
+			flags = append(flags, flag.Name+":"+flag.Value)
+		}
+		if strings.Join(flags, ",") != expects {
+			t.Errorf("Emit() expects %v with %v, got %v", expects, policy, strings.Join(flags, ","))
+		}
+	}
+}
+
+func Test_Configuration_SplitFunc(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first one\x00  // .nested two\x00// .second three"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		SplitFunc: func(data []byte, atEOF bool) (int, []byte, error) {
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		},
+		ParallelChunkSize: 8,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(emits.Data) != 2 || emits.Data[0].Keyword != "first" || emits.Data[1].Keyword != "second" {
+		t.Fatalf("Emit() expects first and second, got %v", emits.Data)
+	}
+	if len(emits.Data[0].Data) != 1 || emits.Data[0].Data[0].Keyword != "nested" || emits.Data[0].Data[0].Line != 2 {
+		t.Errorf("Emit() expects nested on line 2, got %v", emits.Data[0].Data)
+	}
+	if f.Child[1].Line.StartOffset != 31 {
+		t.Errorf("BuildReader() expects offset 31, got %v", f.Child[1].Line.StartOffset)
+	}
+}
+
+func Test_Emit_Flag_Shapes(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword`name:value,named:,bare` value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	expects := []core.EmitFlag{
+		{Name: "name", Value: "value"},
+		{Name: "named"},
+		{Value: "bare"},
+	}
+	flags := emits.Data[0].Flag
+	if len(flags) != len(expects) {
+		t.Fatalf("Emit() expects %v flags, got %v", len(expects), len(flags))
+	}
+	for i, flag := range flags {
+		if flag.Name != expects[i].Name || flag.Value != expects[i].Value {
+			t.Errorf("Emit() expects %v:%v, got %v:%v", expects[i].Name, expects[i].Value, flag.Name, flag.Value)
+		}
+	}
+}
+
+func Test_Configuration_EmitEmptyArrays(t *testing.T) {
+	for _, empty := range []bool{false, true} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			EmitEmptyArrays: empty,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		data, err := json.Marshal(emits.Data[0])
+		if err != nil {
+			t.Errorf("Marshal() expects nil, got %v", err)
+		}
+		expects := `{"keyword":"keyword","value":"value","lineStart":1,"lineEnd":1}`
+		if empty {
+			expects = `{"keyword":"keyword","value":"value","lineStart":1,"lineEnd":1,"flag":[],"data":[]}`
+		}
+		if string(data) != expects {
+			t.Errorf("Marshal() expects %v, got %v", expects, string(data))
+		}
+	}
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("package main\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		EmitEmptyArrays: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	data, err := json.Marshal(emits.File("", nil))
+	if err != nil {
+		t.Errorf("Marshal() expects nil, got %v", err)
+	}
+	if !strings.HasSuffix(string(data), `"data":[]}`) {
+		t.Errorf("Marshal() expects empty data array, got %v", string(data))
+	}
+}
+
+func Test_RegularExpression_Flags(t *testing.T) {
+	c := &core.Configuration{
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find: "todo",
+			},
+			{
+				Find:       "todo",
+				IgnoreCase: true,
+			},
+			{
+				Find:      "^b",
+				Multiline: true,
+			},
+			{
+				Find:       "^B",
+				IgnoreCase: true,
+				Multiline:  true,
+			},
+		},
+	}
+	err := c.CompileRegularExpressions()
+	if err != nil {
+		t.Errorf("CompileRegularExpressions() expects nil, got %v", err)
+	}
+	r := *c.RegularExpression
+	for i, expects := range []string{"TODO", "x", "a\nx", "a\nx"} {
+		input := "TODO"
+		if i > 1 {
+			input = "a\nb"
+		}
+		value := r[i].Compiled.ReplaceAllString(input, "x")
+		if value != expects {
+			t.Errorf("ReplaceAllString() expects %q for %v, got %q", expects, r[i].Compiled, value)
+		}
+	}
+}
+
+func Test_RegularExpression_Scope(t *testing.T) {
+	for scope, expects := range map[string][]string{
+		"":                {".example use bar", "bar()"},
+		core.ScopeAll:     {".example use bar", "bar()"},
+		core.ScopeComment: {".example use bar", "foo()"},
+		core.ScopeExposed: {".example use foo", "bar()"},
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .example use foo >\nfoo()\n"), "main.go", &core.Configuration{
+			Expose: true,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			RegularExpression: &[]core.RegularExpression{
+				{
+					Find:    "foo",
+					Replace: "bar",
+					Scope:   scope,
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		var values []string
+		for _, c := range f.Child {
+			values = append(values, c.Line.Value)
+			for _, d := range c.Child {
+				values = append(values, d.Line.Value)
+			}
+		}
+		if strings.Join(values, ",") != strings.Join(expects, ",") {
+			t.Errorf("RegularExpression() expects %v with scope %v, got %v", expects, scope, values)
+		}
+	}
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .example use foo\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:  "foo",
+				Scope: "code",
+			},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown scope code") {
+		t.Errorf("BuildReader() expects unknown scope error, got %v", err)
+	}
+}
+
+func Test_EmitNode_Dedupe(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first one\n  //\n  //\n  //\n  // text\n  //\n//\n//\n// .second two\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	emits.Dedupe()
+	if len(emits.Data) != 3 {
+		t.Fatalf("Dedupe() expects 3 Data, got %v", len(emits.Data))
+	}
+	if emits.Data[1].LineStart != 7 || emits.Data[1].LineEnd != 8 {
+		t.Errorf("Dedupe() expects the empty run to span lines 7-8, got %v-%v", emits.Data[1].LineStart, emits.Data[1].LineEnd)
+	}
+	var values []string
+	for _, d := range emits.Data[0].Data {
+		values = append(values, d.Value)
+	}
+	if strings.Join(values, ",") != ",text," {
+		t.Errorf("Dedupe() expects ,text, got %v", strings.Join(values, ","))
+	}
+}
+
+func Test_Configuration_IncludeKeyword(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"main.go":  "// .include`path:lib.go` library\n// .note main\n",
+		"lib.go":   "// .note lib\n// .include cycle.go\n",
+		"cycle.go": "// .note cycle\n// .include main.go\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &core.FileNode{}
+	_, err := f.Build(filepath.Join(dir, "main.go"), &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		IncludeKeyword: "include",
+	})
+	if err != nil {
+		t.Errorf("Build() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	include := emits.Data[0]
+	if len(include.Data) != 2 || include.Data[0].Value != "lib" {
+		t.Fatalf("Emit() expects lib.go inlined, got %v", include.Data)
+	}
+	nested := include.Data[1]
+	if nested.Keyword != "include" || len(nested.Data) != 2 || nested.Data[0].Value != "cycle" {
+		t.Fatalf("Emit() expects cycle.go inlined, got %v", nested.Data)
+	}
+	if len(nested.Data[1].Data) != 0 {
+		t.Errorf("Emit() expects main.go not to be inlined, got %v", nested.Data[1].Data)
+	}
+	if len(f.Diagnostic) != 1 || f.Diagnostic[0].Line != 1 || !strings.Contains(f.Diagnostic[0].Message, "include cycle") {
+		t.Errorf("Emit() expects an include cycle Diagnostic on line 1, got %v", f.Diagnostic)
+	}
+	_, err = f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	if len(f.Diagnostic) != 1 {
+		t.Errorf("Emit() expects the include cycle Diagnostic once when emitted again, got %v", f.Diagnostic)
+	}
+}
+
+func Test_Configuration_IncludeKeyword_Comment(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"main.go": "// .include lib.py\n",
+		"lib.py":  "# .note python\n// .note go\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &core.FileNode{}
+	_, err := f.Build(filepath.Join(dir, "main.go"), &core.Configuration{
+		IncludeKeyword: "include",
+	})
+	if err != nil {
+		t.Errorf("Build() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	include := emits.Data[0]
+	if len(include.Data) != 1 || include.Data[0].Value != "python" {
+		t.Errorf("Emit() expects lib.py scanned with its own comment tokens, got %v", include.Data)
+	}
+}
+
+func Test_RegularExpression_ReplaceFunc(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .note todo: fix todo\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:        "todo",
+				Replace:     "ignored",
+				ReplaceFunc: strings.ToUpper,
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	if f.Child[0].Line.Value != ".note TODO: fix TODO" {
+		t.Errorf("RegularExpression() expects .note TODO: fix TODO, got %v", f.Child[0].Line.Value)
+	}
+}
+
+func Test_Configuration_RegexAfterEmit(t *testing.T) {
+	for after, expects := range map[bool]string{
+		false: "x:role:z:x y",
+		true:  "note:role:admin:x y",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .note`role:admin` note about admin\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+			RegularExpression: &[]core.RegularExpression{
+				{
+					Find:    "note",
+					Replace: "x",
+				},
+				{
+					Find:    "about admin",
+					Replace: "y",
+				},
+				{
+					Find:    "admin",
+					Replace: "z",
+				},
+			},
+			RegexAfterEmit: after,
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		d := emits.Data[0]
+		got := fmt.Sprintf("%v:%v:%v:%v", d.Keyword, d.Flag[0].Name, d.Flag[0].Value, d.Value)
+		if got != expects {
+			t.Errorf("Emit() expects %v with RegexAfterEmit %v, got %v", expects, after, got)
+		}
+	}
+}
+
+func Test_Configuration_RegexDebug(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .note foo\n// .note bar\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:    "foo",
+				Replace: "bar",
+			},
+			{
+				Find:    "baz",
+				Replace: "qux",
+			},
+			{
+				Find:    "bar",
+				Replace: "bar",
+			},
+			{
+				Find:    "note",
+				Replace: "todo",
+			},
+		},
+		RegexDebug: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	for i, expects := range []string{"[0 3]", "[3]"} {
+		if got := fmt.Sprint(f.Child[i].Line.Modified); got != expects {
+			t.Errorf("RegularExpression() expects %v modified line %v, got %v", expects, i+1, got)
+		}
+	}
+}
+
+func Test_Configuration_RegexDebug_RegexAfterEmit(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .note foo\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find:    "foo",
+				Replace: "bar",
+			},
+		},
+		RegexDebug:     true,
+		RegexAfterEmit: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		if got := fmt.Sprint(f.Child[0].Line.Modified); got != "[0]" {
+			t.Errorf("Emit() expects [0] modified after emit %v, got %v", i+1, got)
+		}
+	}
+}
+
+func Test_BuildError(t *testing.T) {
+	c := &core.Configuration{
+		RegularExpression: &[]core.RegularExpression{
+			{
+				Find: "a(",
+			},
+			{
+				Find: "b",
+			},
+			{
+				Find: "c[",
+			},
+		},
+	}
+	err := c.CompileRegularExpressions()
+	var buildErr *core.BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("CompileRegularExpressions() expects BuildError, got %v", err)
+	}
+	if len(buildErr.Err) != 2 {
+		t.Errorf("CompileRegularExpressions() expects 2 errors, got %v", len(buildErr.Err))
+	}
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) || syntaxErr.Expr != "a(" {
+		t.Errorf("CompileRegularExpressions() expects a syntax error for a(, got %v", syntaxErr)
+	}
+	syntaxErr = nil
+	if !buildErr.As(&syntaxErr) || syntaxErr.Expr != "a(" || !buildErr.Is(buildErr.Err[1]) || buildErr.Is(errors.New("other")) {
+		t.Errorf("BuildError expects Is and As to match each error without Unwrap, got %v", syntaxErr)
+	}
+	if err.Error() != "could not compile regular expression: error parsing regexp: missing closing ): `a(`, error parsing regexp: missing closing ]: `[`" {
+		t.Errorf("CompileRegularExpressions() expects a readable message, got %v", err)
+	}
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "fail.sh")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := &core.FileNode{}
+	_, err = f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				plugin,
+			},
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
+	})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &buildErr) || len(buildErr.Err) != 1 || !errors.As(err, &exitErr) {
+		t.Errorf("BuildReader() expects a BuildError wrapping the plugin exit error, got %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), plugin) {
+		t.Errorf("BuildReader() expects the plugin path in %v", err)
+	}
+}
+
+func Test_Build_Plugin_Error_Message(t *testing.T) {
+	dir := t.TempDir()
+	var plugins []core.Plugin
+	for _, name := range []string{"first.sh", "second.sh"} {
+		plugin := filepath.Join(dir, name)
+		if err := os.WriteFile(plugin, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		plugins = append(plugins, core.Plugin{
+			Path: plugin,
+		})
+	}
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &plugins,
+	})
+	if err == nil {
+		t.Fatalf("BuildReader() expects error, got nil")
+	}
+	message := strings.TrimPrefix(err.Error(), "could not run plugins: ")
+	segments := strings.Split(message, ", ")
+	if len(segments) != 2 {
+		t.Errorf("BuildReader() expects 2 plugin errors, got %v", err)
+	}
+	for _, segment := range segments {
+		if len(strings.Trim(segment, ", ")) == 0 {
+			t.Errorf("BuildReader() expects no empty plugin errors, got %v", err)
+		}
+	}
+}
+
+func Test_Build_Plugin_Invalid_JSON(t *testing.T) {
+	plugin := filepath.Join(t.TempDir(), "invalid.sh")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\necho '{' > \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .keyword value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Plugin: &[]core.Plugin{
+			{
+				plugin,
+			},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "could not read intermediate file") {
+		t.Errorf("BuildReader() expects intermediate file error, got %v", err)
+	}
+}
+
+func Test_FileNode_Sanitize(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .first one\nvar a = 1\nvar b = 2\n// .second two\nfunc main() {\n  a := 1\n  b := 2\n  // .nested three\n}\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	var lines []string
+	var walk func(n *core.FileNode)
+	walk = func(n *core.FileNode) {
+		for _, c := range n.Child {
+			lines = append(lines, fmt.Sprint(c.Line.Number))
+			walk(c)
+		}
+	}
+	walk(f)
+	if strings.Join(lines, ",") != "1,4,5,8" {
+		t.Errorf("Sanitize() expects lines 1,4,5,8, got %v", strings.Join(lines, ","))
+	}
+}
+
+func Test_FileNode_Sanitize_Exposed_Blank(t *testing.T) {
+	for _, preserve := range []bool{true, false} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader("// .example usage >\nfunc a() {\n\n\tb()\n}\n// .note end\n\nvar c\n"), "main.go", &core.Configuration{
+			Expose:                    true,
+			ExposeBlock:               true,
+			PreserveExposedWhitespace: preserve,
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		if len(emits.Data) != 2 || len(emits.Data[0].Data) != 1 {
+			t.Fatalf("Emit() expects the example and note, got %v", emits.Data)
+		}
+		code := emits.Data[0].Data[0]
+		if preserve && code.Value != "func a() {\n\n b()\n}" {
+			t.Errorf("Emit() expects the blank line to be preserved, got %q", code.Value)
+		} else if !preserve && code.Value != "func a() {\n b()\n}" {
+			t.Errorf("Emit() expects the blank line to be removed, got %q", code.Value)
+		}
+		if code.LineStart != 2 || code.LineEnd != 5 {
+			t.Errorf("Emit() expects the code on lines 2 to 5, got %v to %v", code.LineStart, code.LineEnd)
+		}
+		if emits.Data[1].LineEnd != 6 {
+			t.Errorf("Emit() expects blank lines outside exposed code to be removed, got line %v", emits.Data[1].LineEnd)
+		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Location contains the source file and line of an EmitNode
+type Location struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Index maps each EmitNode keyword to every Location it appears; safe for concurrent use
+type Index struct {
+	mutex   sync.Mutex
+	keyword map[string][]Location
+}
+
+// NewIndex returns an empty Index
+func NewIndex() *Index {
+	return &Index{
+		keyword: make(map[string][]Location),
+	}
+}
+
+// Add records the Location of the provided keyword
+func (i *Index) Add(keyword string, location Location) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.keyword == nil {
+		i.keyword = make(map[string][]Location)
+	}
+	i.keyword[keyword] = append(i.keyword[keyword], location)
+}
+
+// AddEmitNode records the Location of every keyword within the EmitNode tree
+func (i *Index) AddEmitNode(file string, e *EmitNode) {
+	if len(e.Keyword) > 0 {
+		i.Add(e.Keyword, Location{
+			File: file,
+			Line: e.Line,
+		})
+	}
+	for _, d := range e.Data {
+		i.AddEmitNode(file, d)
+	}
+}
+
+// Keyword returns a copy of the Index with each Location sorted by file and line
+func (i *Index) Keyword() map[string][]Location {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	keyword := make(map[string][]Location, len(i.keyword))
+	for k, l := range i.keyword {
+		locations := append([]Location(nil), l...)
+		sort.Slice(locations, func(a, b int) bool {
+			if locations[a].File != locations[b].File {
+				return locations[a].File < locations[b].File
+			}
+			return locations[a].Line < locations[b].Line
+		})
+		keyword[k] = locations
+	}
+	return keyword
+}
+
+// FileResult contains the FileNode built from Path, or the error which prevented it
+type FileResult struct {
+	Path     string
+	FileNode *FileNode
+	Err      error
+}
+
+// FileError contains the error which prevented the file at Path, relative to the directory built, from building
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Error returns the Path followed by the error
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the error for errors.Is and errors.As
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// BuildFiles builds every path across concurrency workers, returning a FileResult for each in the order of paths; a non-positive concurrency uses GOMAXPROCS
+func BuildFiles(paths []string, configuration *Configuration, concurrency int) []*FileResult {
+	return buildFiles(paths, configuration, concurrency, nil)
+}
+
+// buildFiles is BuildFiles which, if each is not nil, calls each from the worker with the index of every path built; an error from each fails the path
+func buildFiles(paths []string, configuration *Configuration, concurrency int, each func(i int, f *FileNode) error) []*FileResult {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	results := make([]*FileResult, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				f := &FileNode{}
+				_, err := f.Build(paths[i], configuration.clone())
+				if err == nil && each != nil {
+					err = each(i, f)
+				}
+				result := &FileResult{
+					Path: paths[i],
+					Err:  err,
+				}
+				if err == nil {
+					result.FileNode = f
+				}
+				results[i] = result
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// matchFiles returns the relative slash separated path of every regular file within root which Configuration Matches, in lexical order
+func matchFiles(root string, configuration *Configuration) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if configuration.Matches(rel) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not walk directory: %v", err)
+	}
+	return paths, nil
+}
+
+// buildDirectory builds every file within root which Configuration Matches across concurrency workers, see buildFiles, returning the relative path and FileResult of each
+func buildDirectory(root string, configuration *Configuration, concurrency int, each func(rel string, f *FileNode) error) ([]string, []*FileResult, error) {
+	if configuration == nil {
+		return nil, nil, fmt.Errorf("could not build directory: configuration is nil")
+	}
+	rels, err := matchFiles(root, configuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, len(rels))
+	for i, rel := range rels {
+		paths[i] = filepath.Join(root, filepath.FromSlash(rel))
+	}
+	if each == nil {
+		return rels, BuildFiles(paths, configuration, concurrency), nil
+	}
+	return rels, buildFiles(paths, configuration, concurrency, func(i int, f *FileNode) error {
+		return each(rels[i], f)
+	}), nil
+}
+
+// BuildDirectory builds every file within root which Configuration Matches, returning each FileNode keyed by relative path; files which fail to build are returned as a FileError of each within a BuildError
+func BuildDirectory(root string, configuration *Configuration) (map[string]*FileNode, error) {
+	rels, results, err := buildDirectory(root, configuration, 1, nil)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*FileNode)
+	buildErr := &BuildError{
+		Message: "could not build directory",
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			buildErr.Err = append(buildErr.Err, &FileError{
+				Path: rels[i],
+				Err:  result.Err,
+			})
+			continue
+		}
+		files[rels[i]] = result.FileNode
+	}
+	if len(buildErr.Err) > 0 {
+		return files, buildErr
+	}
+	return files, nil
+}
+
+// BuildDir builds and emits every file within root across concurrency workers, see BuildFiles, each adding to an Index of all keywords keyed by relative path; files which fail are returned as a FileError of each within a BuildError
+func BuildDir(root string, configuration *Configuration, concurrency int) (*Index, error) {
+	index := NewIndex()
+	rels, results, err := buildDirectory(root, configuration, concurrency, func(rel string, f *FileNode) error {
+		emits, err := f.Emit()
+		if err != nil {
+			return err
+		}
+		index.AddEmitNode(rel, emits)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	buildErr := &BuildError{
+		Message: "could not build directory",
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			buildErr.Err = append(buildErr.Err, &FileError{
+				Path: rels[i],
+				Err:  result.Err,
+			})
+		}
+	}
+	if len(buildErr.Err) > 0 {
+		return index, buildErr
+	}
+	return index, nil
+}
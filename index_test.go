@@ -0,0 +1,240 @@
+package core_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emits-io/core"
+)
+
+func Test_BuildDir_Index(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 8; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%v", i%2))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		data := "// .todo first\nfunc main() {}\n// .todo second\n// .note other\n"
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%v.go", i)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := core.BuildDir(root, &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	}, 3)
+	if err != nil {
+		t.Errorf("BuildDir() expects nil, got %v", err)
+	}
+	keyword := index.Keyword()
+	if len(keyword["todo"]) != 16 {
+		t.Errorf("Keyword() todo expects 16 locations, got %v", len(keyword["todo"]))
+	}
+	if len(keyword["note"]) != 8 {
+		t.Errorf("Keyword() note expects 8 locations, got %v", len(keyword["note"]))
+	}
+	l := keyword["todo"][0]
+	if l.File != "pkg0/file0.go" || l.Line != 1 {
+		t.Errorf("Keyword() todo expects pkg0/file0.go:1, got %v:%v", l.File, l.Line)
+	}
+}
+
+func Test_Index_Add(t *testing.T) {
+	index := &core.Index{}
+	index.Add("todo", core.Location{File: "b.go", Line: 1})
+	index.Add("todo", core.Location{File: "a.go", Line: 2})
+	keyword := index.Keyword()
+	if len(keyword["todo"]) != 2 || keyword["todo"][0].File != "a.go" {
+		t.Errorf("Keyword() expects sorted locations, got %v", keyword["todo"])
+	}
+}
+
+func Test_Index_Concurrent(t *testing.T) {
+	index := core.NewIndex()
+	emits := &core.EmitNode{
+		Data: []*core.EmitNode{
+			{
+				Keyword: "todo",
+				Line:    1,
+			},
+		},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file := fmt.Sprintf("file%v.go", i)
+			for line := 0; line < 100; line++ {
+				index.Add("note", core.Location{File: file, Line: line})
+				index.AddEmitNode(file, emits)
+			}
+			index.Keyword()
+		}(i)
+	}
+	wg.Wait()
+	keyword := index.Keyword()
+	if len(keyword["note"]) != 800 || len(keyword["todo"]) != 800 {
+		t.Errorf("Keyword() expects 800 locations of each keyword, got %v and %v", len(keyword["note"]), len(keyword["todo"]))
+	}
+}
+
+func Test_BuildDirectory(t *testing.T) {
+	root := t.TempDir()
+	for path, data := range map[string]string{
+		"main.go":           "// .todo main\n",
+		"pkg/lib.go":        "// .todo lib\n",
+		"pkg/lib_test.go":   "// .todo test\n",
+		"vendor/dep/dep.go": "// .todo vendor\n",
+		"readme.md":         "# readme\n",
+		"pkg/sub/sub.go":    "// .todo sub\n",
+	} {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := core.BuildDirectory(root, &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		Include: []string{"*.go"},
+		Exclude: []string{"*_test.go", "vendor/*/*"},
+	})
+	if err != nil {
+		t.Errorf("BuildDirectory() expects nil, got %v", err)
+	}
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "main.go,pkg/lib.go,pkg/sub/sub.go" {
+		t.Errorf("BuildDirectory() expects main.go,pkg/lib.go,pkg/sub/sub.go, got %v", paths)
+	}
+}
+
+func Test_BuildDirectory_Error(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.unknown", "c.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("// .todo value\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := core.BuildDirectory(root, &core.Configuration{})
+	var buildErr *core.BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Err) != 1 {
+		t.Fatalf("BuildDirectory() expects a BuildError of b.unknown, got %v", err)
+	}
+	var fileErr *core.FileError
+	if !errors.As(buildErr.Err[0], &fileErr) || fileErr.Path != "b.unknown" || fileErr.Err == nil {
+		t.Errorf("BuildDirectory() expects a FileError of b.unknown, got %v", buildErr.Err[0])
+	}
+	if len(files) != 2 || files["a.go"] == nil || files["c.go"] == nil {
+		t.Errorf("BuildDirectory() expects a.go and c.go despite errors, got %v", files)
+	}
+}
+
+func Test_BuildFiles(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := 0; i < 12; i++ {
+		ext := ".go"
+		if i%5 == 4 {
+			ext = ".unknown"
+		}
+		path := filepath.Join(root, fmt.Sprintf("file%v%v", i, ext))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("// .todo file%v\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	results := core.BuildFiles(paths, &core.Configuration{
+		Plugin: &[]core.Plugin{
+			{
+				"./testdata/plugin/foo.js",
+			},
+		},
+	}, 3)
+	if len(results) != len(paths) {
+		t.Fatalf("BuildFiles() expects %v results, got %v", len(paths), len(results))
+	}
+	for i, result := range results {
+		if result.Path != paths[i] {
+			t.Errorf("BuildFiles() expects %v, got %v", paths[i], result.Path)
+		}
+		if i%5 == 4 {
+			if result.Err == nil || result.FileNode != nil {
+				t.Errorf("BuildFiles() expects an error for %v, got %v", result.Path, result.Err)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("BuildFiles() expects nil, got %v", result.Err)
+			continue
+		}
+		emits, err := result.FileNode.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %v", err)
+		}
+		if len(emits.Data) != 1 || emits.Data[0].Value != fmt.Sprintf("file%v", i) {
+			t.Errorf("BuildFiles() expects file%v, got %v", i, emits.Data)
+		}
+	}
+}
+
+func Test_BuildFiles_Nil(t *testing.T) {
+	results := core.BuildFiles([]string{"core.go"}, nil, 1)
+	if len(results) != 1 || results[0].Err == nil || results[0].FileNode != nil {
+		t.Errorf("BuildFiles() expects a configuration is nil error, got %v", results[0])
+	}
+	_, err := core.BuildDirectory(".", nil)
+	if err == nil {
+		t.Errorf("BuildDirectory() expects a configuration is nil error, got nil")
+	}
+	_, err = core.BuildDir(".", nil, 1)
+	if err == nil {
+		t.Errorf("BuildDir() expects a configuration is nil error, got nil")
+	}
+}
+
+func Test_BuildDir_Error(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"c.unknown", "a.go", "b.unknown"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("// .todo value\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := core.BuildDir(root, &core.Configuration{}, 2)
+	var buildErr *core.BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Err) != 2 {
+		t.Fatalf("BuildDir() expects a BuildError of 2 files, got %v", err)
+	}
+	for i, path := range []string{"b.unknown", "c.unknown"} {
+		var fileErr *core.FileError
+		if !errors.As(buildErr.Err[i], &fileErr) || fileErr.Path != path {
+			t.Errorf("BuildDir() expects a FileError of %v, got %v", path, buildErr.Err[i])
+		}
+	}
+	if len(index.Keyword()["todo"]) != 1 {
+		t.Errorf("BuildDir() expects a.go indexed despite errors, got %v", index.Keyword())
+	}
+}
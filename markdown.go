@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMarkdownKeyword is the Markdown prefix of each EmitNode keyword used by RenderMarkdown when MarkdownOptions.Keyword is nil
+var DefaultMarkdownKeyword = map[string]string{
+	"title":       "# ",
+	"section":     "## ",
+	"function":    "### ",
+	"type":        "### ",
+	"description": "",
+	"param":       "- ",
+	"return":      "- Returns ",
+	"example":     "> ",
+}
+
+// MarkdownOptions contains the Markdown rendering of EmitNode keywords for RenderMarkdown
+type MarkdownOptions struct {
+	// Keyword maps each EmitNode keyword to the Markdown prefix of its value, e.g. "# " for a heading or "- " for a bullet; unmapped keywords are rendered as paragraphs
+	Keyword map[string]string
+}
+
+// markdownWriter accumulates Markdown lines, separating blocks by a blank line
+type markdownWriter struct {
+	builder strings.Builder
+	keyword map[string]string
+	list    bool
+}
+
+// RenderMarkdown returns the EmitNode tree as Markdown; bullets nest their flags, as "name: value" sub-bullets, and children beneath them, while other keywords start a new block
+func RenderMarkdown(e *EmitNode, opts *MarkdownOptions) (string, error) {
+	if e == nil {
+		return "", fmt.Errorf("could not render markdown: nil EmitNode")
+	}
+	m := &markdownWriter{
+		keyword: DefaultMarkdownKeyword,
+	}
+	if opts != nil && opts.Keyword != nil {
+		m.keyword = opts.Keyword
+	}
+	if len(e.Keyword) > 0 {
+		m.node(e, "")
+	} else {
+		for _, d := range e.Data {
+			m.node(d, "")
+		}
+	}
+	return m.builder.String(), nil
+}
+
+// node writes e, its flags, and its children; indent is non-empty when e is nested beneath a bullet
+func (m *markdownWriter) node(e *EmitNode, indent string) {
+	prefix := m.keyword[e.Keyword]
+	if isMarkdownBullet(prefix) {
+		m.line(indent, prefix, e.Value, true)
+		m.flags(e.Flag, indent+"  ")
+		for _, d := range e.Data {
+			m.node(d, indent+"  ")
+		}
+		return
+	}
+	if len(indent) > 0 {
+		if len(e.Value) > 0 {
+			m.line(indent, "", e.Value, true)
+		}
+		for _, d := range e.Data {
+			m.node(d, indent)
+		}
+		return
+	}
+	if len(e.Value) > 0 || len(prefix) > 0 {
+		m.line("", prefix, e.Value, false)
+	}
+	m.flags(e.Flag, "")
+	for _, d := range e.Data {
+		m.node(d, "")
+	}
+}
+
+// flags writes each EmitFlag, and its nested flags, as a "name: value" bullet
+func (m *markdownWriter) flags(flags []*EmitFlag, indent string) {
+	for _, f := range flags {
+		value := f.Value
+		if len(f.Name) > 0 && len(f.Value) > 0 {
+			value = f.Name + ": " + f.Value
+		} else if len(f.Name) > 0 {
+			value = f.Name
+		}
+		m.line(indent, "- ", value, true)
+		m.flags(f.Flag, indent+"  ")
+	}
+}
+
+// line writes prefix and value at indent, continuing multiline values at the same indent, preceded by a blank line unless it continues a list
+func (m *markdownWriter) line(indent string, prefix string, value string, list bool) {
+	if m.builder.Len() > 0 && !(list && m.list) {
+		m.builder.WriteString("\n")
+	}
+	m.list = list
+	continuation := indent + strings.Repeat(" ", len(prefix))
+	if !list {
+		continuation = prefix
+		if strings.HasPrefix(prefix, "#") {
+			continuation = ""
+		}
+	}
+	m.builder.WriteString(indent + prefix + strings.ReplaceAll(value, "\n", "\n"+continuation) + "\n")
+}
+
+// isMarkdownBullet reports whether prefix starts a Markdown list item
+func isMarkdownBullet(prefix string) bool {
+	return strings.HasPrefix(prefix, "- ") || strings.HasPrefix(prefix, "* ") || strings.HasPrefix(prefix, "+ ")
+}
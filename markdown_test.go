@@ -0,0 +1,52 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emits-io/core"
+)
+
+func Test_RenderMarkdown(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .title Parser\n// .description Parses the input\n// .function`exported` Parse\n  // .param`type:string,optional` input\n    // .description the source\n  // .return error\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	markdown, err := core.RenderMarkdown(emits, nil)
+	if err != nil {
+		t.Errorf("RenderMarkdown() expects nil, got %v", err)
+	}
+	expected := "# Parser\n\nParses the input\n\n### Parse\n\n- exported\n- input\n  - type: string\n  - optional\n  the source\n- Returns error\n"
+	if markdown != expected {
+		t.Errorf("RenderMarkdown() expects %q, got %q", expected, markdown)
+	}
+	markdown, err = core.RenderMarkdown(emits, &core.MarkdownOptions{
+		Keyword: map[string]string{
+			"title": "## ",
+			"param": "* ",
+		},
+	})
+	if err != nil {
+		t.Errorf("RenderMarkdown() expects nil, got %v", err)
+	}
+	if !strings.HasPrefix(markdown, "## Parser\n") || !strings.Contains(markdown, "* input\n  - type: string\n") {
+		t.Errorf("RenderMarkdown() expects the provided keywords, got %q", markdown)
+	}
+	_, err = core.RenderMarkdown(nil, nil)
+	if err == nil {
+		t.Errorf("RenderMarkdown() expects an error for a nil EmitNode, got nil")
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeywordSchema contains the flags and nesting allowed for an EmitNode keyword
+type KeywordSchema struct {
+	Required []string `json:"required,omitempty"`
+	Optional []string `json:"optional,omitempty"`
+	Nest     bool     `json:"nest,omitempty"`
+}
+
+// LoadDirectiveDefinitions reads KeywordSchema by keyword from the provided JSON or YAML (.yaml, .yml) file
+func LoadDirectiveDefinitions(path string) (map[string]KeywordSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directive definitions: %v", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		// Decoding through generic values keeps the JSON struct tags authoritative
+		var value interface{}
+		err = yaml.Unmarshal(data, &value)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse directive definitions: %v", err)
+		}
+		data, err = json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse directive definitions: %v", err)
+		}
+	}
+	schema := make(map[string]KeywordSchema)
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse directive definitions: %v", err)
+	}
+	return schema, nil
+}
+
+// Validate returns a Diagnostic for each keyword EmitNode that is unknown, is missing a required flag, sets an unknown flag, or nests keywords when not allowed
+func (e *EmitNode) Validate(schema map[string]KeywordSchema) []*Diagnostic {
+	var diagnostic []*Diagnostic
+	for _, d := range e.Data {
+		diagnostic = append(diagnostic, d.validate(schema)...)
+		diagnostic = append(diagnostic, d.Validate(schema)...)
+	}
+	return diagnostic
+}
+
+// validate returns a Diagnostic for each KeywordSchema violation of the EmitNode itself
+func (e *EmitNode) validate(schema map[string]KeywordSchema) []*Diagnostic {
+	if len(e.Keyword) == 0 {
+		return nil
+	}
+	s, ok := schema[e.Keyword]
+	if !ok {
+		return []*Diagnostic{
+			{
+				Severity: DiagnosticWarning,
+				Line:     e.Line,
+				Message:  fmt.Sprintf("unknown keyword %v", e.Keyword),
+			},
+		}
+	}
+	var diagnostic []*Diagnostic
+	flags := make(map[string]bool, len(e.Flag))
+	for _, flag := range e.Flag {
+		flags[flag.Name] = true
+	}
+	for _, name := range s.Required {
+		if !flags[name] {
+			diagnostic = append(diagnostic, &Diagnostic{
+				Severity: DiagnosticError,
+				Line:     e.Line,
+				Message:  fmt.Sprintf("keyword %v is missing required flag %v", e.Keyword, name),
+			})
+		}
+	}
+	allowed := make(map[string]bool, len(s.Required)+len(s.Optional))
+	for _, name := range append(append([]string(nil), s.Required...), s.Optional...) {
+		allowed[name] = true
+	}
+	for _, flag := range e.Flag {
+		if len(flag.Name) > 0 && !allowed[flag.Name] {
+			diagnostic = append(diagnostic, &Diagnostic{
+				Severity: DiagnosticWarning,
+				Line:     e.Line,
+				Message:  fmt.Sprintf("keyword %v has unknown flag %v", e.Keyword, flag.Name),
+			})
+		}
+	}
+	if !s.Nest {
+		for _, d := range e.Data {
+			if len(d.Keyword) > 0 {
+				diagnostic = append(diagnostic, &Diagnostic{
+					Severity: DiagnosticError,
+					Line:     d.Line,
+					Message:  fmt.Sprintf("keyword %v cannot nest keyword %v", e.Keyword, d.Keyword),
+				})
+			}
+		}
+	}
+	return diagnostic
+}
+
+// EmitFileSchema returns a JSON Schema (draft 2020-12) of EmitFile, generated from the JSON struct tags of EmitFile and the types it contains, and the line and file of EmitNode
+func EmitFileSchema() []byte {
+	defs := make(map[string]interface{})
+	for _, t := range []reflect.Type{
+		reflect.TypeOf(EmitFile{}),
+		reflect.TypeOf(EmitMeta{}),
+		reflect.TypeOf(MetaData{}),
+		reflect.TypeOf(EmitNode{}),
+		reflect.TypeOf(EmitFlag{}),
+	} {
+		defs[t.Name()] = structSchema(t)
+	}
+	// EmitNode.MarshalJSON adds line and file; see Configuration.EmitSourceLine and EmitSourceFile
+	properties := defs["EmitNode"].(map[string]interface{})["properties"].(map[string]interface{})
+	properties["line"] = typeSchema(reflect.TypeOf(0))
+	properties["file"] = typeSchema(reflect.TypeOf(""))
+	// Marshaling maps of strings and slices cannot fail
+	data, _ := json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "EmitFile",
+		"$ref":    "#/$defs/EmitFile",
+		"$defs":   defs,
+	}, "", "  ")
+	return data
+}
+
+// structSchema returns the JSON Schema object of a struct type keyed by its JSON struct tags; fields without omitempty are required
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if len(field.PkgPath) > 0 || len(tag[0]) == 0 || tag[0] == "-" {
+			continue
+		}
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		schema := typeSchema(field.Type)
+		if !omitempty {
+			required = append(required, tag[0])
+			if field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Slice {
+				// nil pointers and slices are encoded as null unless omitted
+				schema = map[string]interface{}{
+					"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}},
+				}
+			}
+		}
+		properties[tag[0]] = schema
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema returns the JSON Schema of a field type, referencing structs by their $defs name
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
@@ -0,0 +1,213 @@
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emits-io/core"
+)
+
+func Test_LoadDirectiveDefinitions(t *testing.T) {
+	for _, path := range []string{"testdata/directives.json", "testdata/directives.yaml"} {
+		schema, err := core.LoadDirectiveDefinitions(path)
+		if err != nil {
+			t.Fatalf("LoadDirectiveDefinitions() expects nil, got %s", err)
+		}
+		f := &core.FileNode{}
+		_, err = f.BuildReader(strings.NewReader("// .func`name:foo` first\n  // .param`type:string` a\n  // .param b\n    // .param`type:int` c\n// .other value\n"), "main.go", &core.Configuration{
+			Comment: &core.Comment{
+				Line: "//",
+				Block: &core.CommentBlock{
+					Start: "/*",
+					End:   "*/",
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("BuildReader() expects nil, got %s", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		diagnostic := emits.Validate(schema)
+		var messages []string
+		for _, d := range diagnostic {
+			messages = append(messages, d.Message)
+		}
+		expects := "keyword param is missing required flag type,keyword param cannot nest keyword param,unknown keyword other"
+		if strings.Join(messages, ",") != expects {
+			t.Errorf("Validate() expects %v, got %v", expects, messages)
+		}
+		if diagnostic[0].Line != 3 || diagnostic[0].Severity != core.DiagnosticError {
+			t.Errorf("Validate() expects an error on line 3, got %v", diagnostic[0])
+		}
+	}
+}
+
+func Test_LoadDirectiveDefinitions_Error(t *testing.T) {
+	_, err := core.LoadDirectiveDefinitions("testdata/missing.json")
+	if err == nil {
+		t.Errorf("LoadDirectiveDefinitions() expects error, got nil")
+	}
+}
+
+func Test_Emit_Schema(t *testing.T) {
+	schema, err := core.LoadDirectiveDefinitions("testdata/directives.json")
+	if err != nil {
+		t.Fatalf("LoadDirectiveDefinitions() expects nil, got %s", err)
+	}
+	f := &core.FileNode{}
+	_, err = f.BuildReader(strings.NewReader("// .func first\n"), "main.go", &core.Configuration{
+		Schema: schema,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	// Emitting again replaces, rather than repeats, the diagnostic
+	for i := 0; i < 2; i++ {
+		_, err = f.Emit()
+		if err != nil {
+			t.Errorf("Emit() expects nil, got %s", err)
+		}
+		if len(f.Diagnostic) != 1 || f.Diagnostic[0].Message != "keyword func is missing required flag name" {
+			t.Errorf("Emit() expects a missing flag diagnostic, got %v", f.Diagnostic)
+		}
+	}
+}
+
+// validateSchema returns an error if value does not match the JSON Schema keywords used by EmitFileSchema
+func validateSchema(root map[string]interface{}, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")]
+		if def == nil {
+			return fmt.Errorf("%v: unresolved $ref %v", path, ref)
+		}
+		return validateSchema(root, def.(map[string]interface{}), value, path)
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		for _, s := range anyOf {
+			if validateSchema(root, s.(map[string]interface{}), value, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v: matches no anyOf schema", path)
+	}
+	switch schema["type"] {
+	case "null":
+		if value != nil {
+			return fmt.Errorf("%v: expects null", path)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%v: expects string", path)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%v: expects integer", path)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v: expects array", path)
+		}
+		for i, item := range items {
+			err := validateSchema(root, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%v[%v]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v: expects object", path)
+		}
+		for _, name := range schema["required"].([]interface{}) {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%v: missing required %v", path, name)
+			}
+		}
+		properties := schema["properties"].(map[string]interface{})
+		for name, v := range object {
+			property, ok := properties[name]
+			if !ok {
+				return fmt.Errorf("%v: unexpected property %v", path, name)
+			}
+			err := validateSchema(root, property.(map[string]interface{}), v, path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Test_EmitFileSchema(t *testing.T) {
+	var schema map[string]interface{}
+	err := json.Unmarshal(core.EmitFileSchema(), &schema)
+	if err != nil {
+		t.Fatalf("EmitFileSchema() expects valid JSON, got %v", err)
+	}
+	if schema["$schema"] != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("EmitFileSchema() expects draft 2020-12, got %v", schema["$schema"])
+	}
+	f := &core.FileNode{}
+	_, err = f.BuildReader(strings.NewReader("// .func`name:foo,author:{name:me,contact:{email:x}}` first\n  // .param`type:string` a\n    // .param c\n// .other value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		NestedFlags: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	file := emits.File("", []*core.MetaData{
+		{
+			Keyword: "layout",
+			Value:   "foo",
+		},
+	})
+	for name, sample := range map[string]*core.EmitFile{
+		"file":   file,
+		"merged": core.MergeEmitFiles([]*core.EmitFile{file, file}),
+	} {
+		data, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatalf("Marshal() expects nil, got %v", err)
+		}
+		var value interface{}
+		json.Unmarshal(data, &value)
+		err = validateSchema(schema, schema, value, "$")
+		if err != nil {
+			t.Errorf("EmitFileSchema() expects %v output to validate, got %v", name, err)
+		}
+	}
+	for name, sample := range map[string]string{
+		"type":     `{"meta":null,"data":[{"keyword":"func","lineStart":"1"}]}`,
+		"property": `{"meta":null,"data":[{"keyword":"func","flag":[{"name":"a","unknown":"b"}]}]}`,
+		"required": `{"data":[]}`,
+	} {
+		var value interface{}
+		json.Unmarshal([]byte(sample), &value)
+		if validateSchema(schema, schema, value, "$") == nil {
+			t.Errorf("EmitFileSchema() expects invalid %v to fail validation, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+// BuildStream scans the provided io.Reader and calls fn with each top level EmitNode once indentation returns to the root, so the FileNode tree is never held in memory; Plugins and whole file options (IncludeKeyword, MetaKeyword, PrimaryKeyword, RootKeyword and Schema) are not applied, and each Diagnostic is discarded, see BuildStreamContext
+func BuildStream(r io.Reader, configuration *Configuration, fn func(*EmitNode) error) error {
+	return BuildStreamContext(context.Background(), r, configuration, fn, nil)
+}
+
+// BuildStreamContext is BuildStream which aborts when the provided context.Context is done;
+// diagnose, if not nil, is called with each Diagnostic, such as an unterminated comment block or a RegexTimeout, in line order before the EmitNode flushed with it
+func BuildStreamContext(ctx context.Context, r io.Reader, configuration *Configuration, fn func(*EmitNode) error, diagnose func(*Diagnostic) error) error {
+	f := &FileNode{}
+	configuration, err := f.configure("", configuration)
+	if err != nil {
+		return err
+	}
+	if configuration.RegularExpression != nil {
+		err = configuration.compileRegularExpressions()
+		if err != nil {
+			return err
+		}
+	}
+	em, err := newEmitter(configuration, f.Name)
+	if err != nil {
+		return err
+	}
+	// emit processes and removes the first n Child of FileNode
+	emit := func(n int) error {
+		chunk := &FileNode{
+			Name:          f.Name,
+			Language:      f.Language,
+			Child:         f.Child[:n],
+			configuration: configuration,
+		}
+		// Copy the remaining Child so emitted FileNode may be collected
+		f.Child = append([]*FileNode(nil), f.Child[n:]...)
+		for _, c := range chunk.Child {
+			c.Parent = chunk
+		}
+		chunk.Sanitize()
+		if configuration.RegularExpression != nil && !configuration.RegexAfterEmit {
+			chunk.regularExpression(chunk, configuration.RegularExpression, configuration.RegexTimeout, configuration.RegexDebug)
+		}
+		em.root = chunk
+		emits, err := chunk.process(em, nil)
+		if err != nil {
+			return err
+		}
+		if len(configuration.MinSeverity) > 0 {
+			order := configuration.SeverityOrder
+			if len(order) == 0 {
+				order = DefaultSeverityOrder
+			}
+			err = emits.FilterSeverity(configuration.MinSeverity, order)
+			if err != nil {
+				return err
+			}
+		}
+		// Diagnostic are recorded on FileNode while scanning and on the chunk while processing
+		if diagnose != nil {
+			diagnostic := append(f.Diagnostic, chunk.Diagnostic...)
+			sort.SliceStable(diagnostic, func(a, b int) bool {
+				return diagnostic[a].Line < diagnostic[b].Line
+			})
+			for _, d := range diagnostic {
+				err = diagnose(d)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		f.Diagnostic = nil
+		for _, e := range emits.Data {
+			if configuration.EmitEmptyArrays {
+				e.markEmptyArrays()
+			}
+			err = fn(e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = f.scan(ctx, r, configuration, func() error {
+		// The last Child may still receive lines, as may the exposed code siblings following an exposed comment
+		n := len(f.Child) - 1
+		for n > 0 && f.Child[n].isExposedCode() {
+			n--
+		}
+		if n <= 0 {
+			return nil
+		}
+		return emit(n)
+	})
+	if err != nil {
+		return err
+	}
+	return emit(len(f.Child))
+}
@@ -0,0 +1,141 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emits-io/core"
+)
+
+func streamConfiguration() *core.Configuration {
+	return &core.Configuration{
+		Expose:      true,
+		ExposeBlock: true,
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	}
+}
+
+// countingReader records the number of bytes read
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func Test_BuildStream(t *testing.T) {
+	for name, data := range map[string]string{
+		"functions": chunkedSource(20),
+		"expose":    "// .example Foo >\nfunc Foo() int {\n    return 1\n}\n// .keyword value\n/* .block\n   continued */\n",
+		"nested":    "// .a\n  // .b\n    // .c\n  // .d\n// .e\n",
+	} {
+		f := &core.FileNode{}
+		_, err := f.BuildReader(strings.NewReader(data), "main.go", streamConfiguration())
+		if err != nil {
+			t.Fatalf("BuildReader() expects nil, got %v", err)
+		}
+		emits, err := f.Emit()
+		if err != nil {
+			t.Fatalf("Emit() expects nil, got %v", err)
+		}
+		expected, _ := json.Marshal(emits.Data)
+		var streamed []*core.EmitNode
+		err = core.BuildStream(strings.NewReader(data), streamConfiguration(), func(e *core.EmitNode) error {
+			streamed = append(streamed, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("BuildStream() expects nil, got %v", err)
+		}
+		actual, _ := json.Marshal(streamed)
+		if string(actual) != string(expected) {
+			t.Errorf("BuildStream() expects %v to equal Emit() %s, got %s", name, expected, actual)
+		}
+	}
+}
+
+func Test_BuildStream_Incremental(t *testing.T) {
+	data := chunkedSource(2000)
+	r := &countingReader{
+		r: strings.NewReader(data),
+	}
+	first := -1
+	err := core.BuildStream(r, streamConfiguration(), func(e *core.EmitNode) error {
+		if first < 0 {
+			first = r.read
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("BuildStream() expects nil, got %v", err)
+	}
+	if first < 0 || first >= len(data) {
+		t.Errorf("BuildStream() expects the first EmitNode before reading %v bytes, got %v", len(data), first)
+	}
+}
+
+func Test_BuildStream_Error(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := core.BuildStream(strings.NewReader(chunkedSource(5)), streamConfiguration(), func(e *core.EmitNode) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("BuildStream() expects the callback error after 1 call, got %v after %v", err, calls)
+	}
+}
+
+func Test_BuildStreamContext_Diagnostic(t *testing.T) {
+	configuration := streamConfiguration()
+	configuration.RegularExpression = &[]core.RegularExpression{
+		{
+			Find:    `((\w+\s*)+)+(x|y|z)?`,
+			Replace: "$1",
+		},
+	}
+	configuration.RegexTimeout = time.Nanosecond
+	var diagnostic []*core.Diagnostic
+	err := core.BuildStreamContext(context.Background(), strings.NewReader("// .keyword "+strings.Repeat("a ", 1<<18)+"\n// .other value\n/* .open\n"), configuration, func(e *core.EmitNode) error {
+		return nil
+	}, func(d *core.Diagnostic) error {
+		diagnostic = append(diagnostic, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("BuildStreamContext() expects nil, got %v", err)
+	}
+	unterminated := 0
+	for _, d := range diagnostic {
+		if d.Message == "unterminated comment block" && d.Line == 3 {
+			unterminated++
+		}
+	}
+	if len(diagnostic) == 0 || diagnostic[0].Line != 1 || !strings.Contains(diagnostic[0].Message, "exceeded") || unterminated != 1 {
+		t.Errorf("BuildStreamContext() expects a timeout Diagnostic on line 1 and an unterminated comment block Diagnostic on line 3, got %v", len(diagnostic))
+	}
+	stop := errors.New("stop")
+	err = core.BuildStreamContext(context.Background(), strings.NewReader("/* .open\n"), streamConfiguration(), func(e *core.EmitNode) error {
+		return nil
+	}, func(d *core.Diagnostic) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("BuildStreamContext() expects the diagnose error, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// TemplateFuncs returns the functions available to RenderTemplate, which must be added to a template before it is parsed:
+// flag returns the named EmitFlag value of an EmitNode, hasFlag reports whether it has one, and render executes the named template with the provided data for recursion over Data
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"flag": func(name string, e *EmitNode) string {
+			value, _ := e.FlagValue(name)
+			return value
+		},
+		"hasFlag": func(name string, e *EmitNode) bool {
+			return e.HasFlag(name)
+		},
+		"render": func(name string, data interface{}) (string, error) {
+			return "", fmt.Errorf("could not render template %v: RenderTemplate is required", name)
+		},
+	}
+}
+
+// RenderTemplate executes tmpl, parsed with TemplateFuncs, with the EmitNode and returns the output
+func RenderTemplate(e *EmitNode, tmpl *template.Template) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", fmt.Errorf("could not clone template %v: %v", tmpl.Name(), err)
+	}
+	funcs := TemplateFuncs()
+	funcs["render"] = func(name string, data interface{}) (string, error) {
+		var buf bytes.Buffer
+		err := clone.ExecuteTemplate(&buf, name, data)
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	clone.Funcs(funcs)
+	var buf bytes.Buffer
+	err = clone.Execute(&buf, e)
+	if err != nil {
+		return "", fmt.Errorf("could not execute template %v: %v", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,53 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/emits-io/core"
+)
+
+func Test_RenderTemplate(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .function`exported:true` Parse\n  // .param`type:string` input\n    // .description the source\n  // .return error\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %v", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %v", err)
+	}
+	tmpl, err := template.New("html").Funcs(core.TemplateFuncs()).Parse(
+		`<ul>{{range .Data}}{{render "node" .}}{{end}}</ul>` +
+			`{{define "node"}}<li class="{{.Keyword}}">{{.Value}}{{if hasFlag "exported" .}} (exported){{end}}{{with flag "type" .}} : {{.}}{{end}}` +
+			`{{if .Data}}<ul>{{range .Data}}{{render "node" .}}{{end}}</ul>{{end}}</li>{{end}}`,
+	)
+	if err != nil {
+		t.Fatalf("Parse() expects nil, got %v", err)
+	}
+	html, err := core.RenderTemplate(emits, tmpl)
+	if err != nil {
+		t.Errorf("RenderTemplate() expects nil, got %v", err)
+	}
+	expected := `<ul><li class="function">Parse (exported)<ul><li class="param">input : string<ul><li class="description">the source</li></ul></li><li class="return">error</li></ul></li></ul>`
+	if html != expected {
+		t.Errorf("RenderTemplate() expects %v, got %v", expected, html)
+	}
+	tmpl, err = template.New("error").Funcs(core.TemplateFuncs()).Parse(`{{render "missing" .}}`)
+	if err != nil {
+		t.Fatalf("Parse() expects nil, got %v", err)
+	}
+	_, err = core.RenderTemplate(emits, tmpl)
+	if err == nil {
+		t.Errorf("RenderTemplate() expects an error for an undefined template, got nil")
+	}
+}
@@ -0,0 +1,5 @@
+#!/usr/bin/env node
+// Pass-through plugin used by tests; rewrites the intermediate FileNode unchanged
+const fs = require('fs');
+const path = process.argv[2];
+fs.writeFileSync(path, JSON.stringify(JSON.parse(fs.readFileSync(path))));
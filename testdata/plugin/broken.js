@@ -0,0 +1,7 @@
+#!/usr/bin/env node
+// Plugin used by tests; links the first nested FileNode to a parent line which does not exist
+const fs = require('fs');
+const path = process.argv[2];
+const root = JSON.parse(fs.readFileSync(path));
+root.child[0].child[0].parent = 999;
+fs.writeFileSync(path, JSON.stringify(root));
@@ -0,0 +1,13 @@
+#!/usr/bin/env node
+// Plugin used by tests; appends the working directory of the plugin to the intermediate FileNode
+const fs = require('fs');
+const path = process.argv[2];
+const root = JSON.parse(fs.readFileSync(path));
+root.child = (root.child || []).concat([{
+  line: {
+    comment: true,
+    value: '.cwd ' + process.cwd(),
+    number: 100,
+  },
+}]);
+fs.writeFileSync(path, JSON.stringify(root));
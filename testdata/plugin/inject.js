@@ -0,0 +1,12 @@
+#!/usr/bin/env node
+// Plugin used by tests; appends an unclassified emits line written with comment syntax to the intermediate FileNode
+const fs = require('fs');
+const path = process.argv[2];
+const root = JSON.parse(fs.readFileSync(path));
+root.child = (root.child || []).concat([{
+  line: {
+    value: '  // .injected value',
+    number: 100,
+  },
+}]);
+fs.writeFileSync(path, JSON.stringify(root));
@@ -0,0 +1,5 @@
+#!/usr/bin/env node
+// Plugin used by tests; pads the intermediate FileNode with 4096 bytes of whitespace
+const fs = require('fs');
+const path = process.argv[2];
+fs.writeFileSync(path, fs.readFileSync(path, 'utf8') + ' '.repeat(4096));
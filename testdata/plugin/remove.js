@@ -0,0 +1,7 @@
+#!/usr/bin/env node
+// Plugin used by tests; removes the first FileNode of the intermediate file
+const fs = require('fs');
+const path = process.argv[2];
+const root = JSON.parse(fs.readFileSync(path));
+root.child = (root.child || []).slice(1);
+fs.writeFileSync(path, JSON.stringify(root));
@@ -0,0 +1,17 @@
+#!/usr/bin/env node
+// Plugin used by tests; reverses the line numbers of the intermediate FileNode
+const fs = require('fs');
+const path = process.argv[2];
+const root = JSON.parse(fs.readFileSync(path));
+const lines = [];
+(function walk(node) {
+  if (node.line) {
+    lines.push(node.line);
+  }
+  (node.child || []).forEach(walk);
+})(root);
+const numbers = lines.map((line) => line.number).reverse();
+lines.forEach((line, i) => {
+  line.number = numbers[i];
+});
+fs.writeFileSync(path, JSON.stringify(root));
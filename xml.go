@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// MarshalXML encodes EmitFile as an emits element named by its JSON struct tags; scalar fields become attributes while flag, data, values, and tag become repeated child elements
+func (e *EmitFile) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	type emitFile EmitFile
+	start.Name = xml.Name{Local: "emits"}
+	return encoder.EncodeElement((*emitFile)(e), start)
+}
+
+// MarshalXML encodes EmitNode as an element named by start; line and file are attributes when serialized, see Configuration.EmitSourceLine and EmitSourceFile
+func (e *EmitNode) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	type emitNode EmitNode
+	node := struct {
+		*emitNode
+		Line int    `xml:"line,attr,omitempty"`
+		File string `xml:"file,attr,omitempty"`
+	}{
+		emitNode: (*emitNode)(e),
+		File:     e.sourceFile,
+	}
+	if e.sourceLine {
+		node.Line = e.Line
+	}
+	return encoder.EncodeElement(node, start)
+}
+
+// WriteXMLTo encodes the EmitFile as an XML document, indented by indent per nesting level, to the provided io.Writer
+func (e *EmitFile) WriteXMLTo(w io.Writer, indent string) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", indent)
+	err := encoder.Encode(e)
+	if err != nil {
+		return 0, err
+	}
+	buf.WriteByte('\n')
+	return buf.WriteTo(w)
+}
+
+// WriteXML generates and saves the EmitNode to disk as XML; an empty inputPath defaults to the name provided at Build
+func (e *EmitNode) WriteXML(inputPath string, outputPath string, meta []*MetaData) error {
+	file := e.File(inputPath, meta)
+	return writeFile(outputPath, writerToFunc(func(w io.Writer) (int64, error) {
+		return file.WriteXMLTo(w, "  ")
+	}))
+}
@@ -0,0 +1,78 @@
+package core_test
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emits-io/core"
+)
+
+func Test_EmitNode_WriteXML(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .func`name:foo,visibility:{scope:exported},exported` first & <second>\n  // .param value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+		NestedFlags: true,
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.xml")
+	err = emits.WriteXML("", path, []*core.MetaData{
+		{
+			Keyword: "layout",
+			Value:   "foo",
+		},
+	})
+	if err != nil {
+		t.Errorf("WriteXML() expects nil, got %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header+"<emits>") || !strings.Contains(string(data), `<data keyword="func"`) {
+		t.Errorf("WriteXML() expects an emits document named by JSON struct tags, got %s", data)
+	}
+	decoder := xml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			if err != io.EOF {
+				t.Errorf("WriteXML() expects well-formed XML, got %s", err)
+			}
+			break
+		}
+	}
+	file := &core.EmitFile{}
+	err = xml.Unmarshal(data, file)
+	if err != nil {
+		t.Errorf("Unmarshal() expects nil, got %s", err)
+	}
+	if file.Meta.File != "main.go" || len(file.Meta.Data) != 1 || file.Meta.Data[0].Value != "foo" {
+		t.Errorf("Unmarshal() expects meta to round-trip, got %v", file.Meta)
+	}
+	n := file.Data[0]
+	if n.Keyword != "func" || n.Value != "first & <second>" || len(n.Flag) != 3 || n.Flag[0].Name != "name" || n.Flag[0].Value != "foo" || n.Flag[2].Value != "exported" {
+		t.Errorf("Unmarshal() expects data and flags to round-trip, got %v", n)
+	}
+	if len(n.Flag[1].Flag) != 1 || n.Flag[1].Flag[0].Name != "scope" || n.Flag[1].Flag[0].Value != "exported" {
+		t.Errorf("Unmarshal() expects nested flags to round-trip, got %v", n.Flag[1])
+	}
+	if len(n.Data) != 1 || n.Data[0].Keyword != "param" || n.Data[0].Value != "value" || n.LineEnd != 2 {
+		t.Errorf("Unmarshal() expects child data to round-trip, got %v", n.Data)
+	}
+}
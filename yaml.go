@@ -0,0 +1,51 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML returns EmitFile as generic values keyed by its JSON struct tags
+func (e *EmitFile) MarshalYAML() (interface{}, error) {
+	data, err := json.Marshal(*e)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// UnmarshalYAML decodes EmitFile from YAML keyed by its JSON struct tags
+func (e *EmitFile) UnmarshalYAML(node *yaml.Node) error {
+	var value interface{}
+	err := node.Decode(&value)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, e)
+}
+
+// WriteYAMLTo encodes the EmitFile as a YAML document to the provided io.Writer
+func (e *EmitFile) WriteYAMLTo(w io.Writer) (int64, error) {
+	data, err := yaml.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// WriteYAML generates and saves the EmitNode to disk as YAML; an empty inputPath defaults to the name provided at Build
+func (e *EmitNode) WriteYAML(inputPath string, outputPath string, meta []*MetaData) error {
+	return writeFile(outputPath, writerToFunc(e.File(inputPath, meta).WriteYAMLTo))
+}
@@ -0,0 +1,86 @@
+package core_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emits-io/core"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_EmitNode_WriteYAML(t *testing.T) {
+	f := &core.FileNode{}
+	_, err := f.BuildReader(strings.NewReader("// .func`name:foo,exported` first\n  // .param value\n"), "main.go", &core.Configuration{
+		Comment: &core.Comment{
+			Line: "//",
+			Block: &core.CommentBlock{
+				Start: "/*",
+				End:   "*/",
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("BuildReader() expects nil, got %s", err)
+	}
+	emits, err := f.Emit()
+	if err != nil {
+		t.Errorf("Emit() expects nil, got %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.yaml")
+	err = emits.WriteYAML("", path, []*core.MetaData{
+		{
+			Keyword: "layout",
+			Value:   "foo",
+		},
+	})
+	if err != nil {
+		t.Errorf("WriteYAML() expects nil, got %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "keyword: func") {
+		t.Errorf("WriteYAML() expects JSON struct tags as keys, got %s", data)
+	}
+	file := &core.EmitFile{}
+	err = yaml.Unmarshal(data, file)
+	if err != nil {
+		t.Errorf("Unmarshal() expects nil, got %s", err)
+	}
+	if file.Meta.File != "main.go" || len(file.Meta.Data) != 1 || file.Meta.Data[0].Value != "foo" {
+		t.Errorf("Unmarshal() expects meta to round-trip, got %v", file.Meta)
+	}
+	n := file.Data[0]
+	if n.Keyword != "func" || n.Value != "first" || len(n.Flag) != 2 || n.Flag[0].Name != "name" || n.Flag[1].Value != "exported" {
+		t.Errorf("Unmarshal() expects data and flags to round-trip, got %v", n)
+	}
+	if len(n.Data) != 1 || n.Data[0].Keyword != "param" || n.LineEnd != 2 {
+		t.Errorf("Unmarshal() expects nested data to round-trip, got %v", n.Data)
+	}
+	path = filepath.Join(t.TempDir(), "main.yaml.gz")
+	err = emits.WriteYAML("", path, nil)
+	if err != nil {
+		t.Errorf("WriteYAML() expects nil, got %s", err)
+	}
+	compressed, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compressed.Close()
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Fatalf("NewReader() expects a gzip stream, got %v", err)
+	}
+	data, err = io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll() expects nil, got %v", err)
+	}
+	if !strings.Contains(string(data), "keyword: func") {
+		t.Errorf("WriteYAML() expects the decompressed output to be YAML, got %s", data)
+	}
+}